@@ -0,0 +1,263 @@
+package funky
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"go/format"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/faiface/crux"
+	"github.com/faiface/funky/compile"
+)
+
+// driverPackage runs the IO of the built programs, the same way funkycmd does
+const driverPackage = "github.com/faiface/funky/interpreters/funkycmd/driver"
+
+func buildProgram(path string, env *compile.Env, main string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	err = writeGoProgram(w, env, main)
+	if err == nil {
+		err = w.Flush()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// writeGoProgram writes a Go main package with one Go function per global, which gets evaluated
+// natively and runs with the funkycmd IO driver.
+func writeGoProgram(w io.Writer, env *compile.Env, main string) error {
+	exprs, errs := env.Exprs(main)
+	if len(errs) > 0 {
+		return errs[0]
+	}
+	if len(exprs[main]) != 1 {
+		return fmt.Errorf("there must be exactly one %s function", main)
+	}
+
+	gen := &generator{env: env, globals: make(map[string][]string)}
+
+	var names []string
+	for name := range exprs {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		gen.globals[name] = make([]string, len(exprs[name]))
+		for i, e := range exprs[name] {
+			if e != nil {
+				gen.globals[name][i] = fmt.Sprintf("g%d", len(gen.globalNames))
+				gen.globalNames = append(gen.globalNames, gen.globals[name][i])
+			}
+		}
+	}
+	for _, name := range names {
+		for i, e := range exprs[name] {
+			if e != nil {
+				gen.global(name, i, e)
+			}
+		}
+	}
+
+	var buf bytes.Buffer
+	printf := func(format string, args ...interface{}) { fmt.Fprintf(&buf, format, args...) }
+	printf("// Code generated by funky -build. DO NOT EDIT.\n\n")
+	printf("package main\n\n")
+	printf("import (\n")
+	printf("\t\"fmt\"\n")
+	printf("\t\"math\"\n")
+	printf("\t\"os\"\n\n")
+	printf("\tcxr \"github.com/faiface/crux/runtime\"\n")
+	printf("\t%q\n", driverPackage)
+	printf("\t\"github.com/faiface/funky/runtime\"\n")
+	printf("\t\"github.com/faiface/funky/runtime/native\"\n")
+	printf(")\n\n")
+
+	// the variables are only assigned in init, initializing them directly would make
+	// initialization cycles of recursive functions
+	printf("var (\n")
+	for _, name := range append(gen.globalNames, gen.constNames...) {
+		printf("\t%s cxr.Value\n", name)
+	}
+	printf(")\n\n")
+	printf("func init() {\n%s\n%s}\n", gen.consts.String(), gen.init.String())
+	printf("%s", gen.funcs.String())
+
+	printf("\nfunc main() {\n")
+	printf("\tdefer func() {\n")
+	printf("\t\tif r := recover(); r != nil {\n")
+	printf("\t\t\tfmt.Fprintln(os.Stderr, \"panic:\", r)\n")
+	printf("\t\t\tos.Exit(1)\n")
+	printf("\t\t}\n")
+	printf("\t}()\n")
+	printf("\tprogram := runtime.NewProgram([]cxr.Value{%s}).Global(0)\n", gen.globals[main][0])
+	printf("\tif err := driver.Run(program, os.Stdin, os.Stdout); err != nil {\n")
+	printf("\t\tfmt.Fprintln(os.Stderr, err)\n")
+	printf("\t\tos.Exit(1)\n")
+	printf("\t}\n")
+	printf("}\n\n")
+
+	// keeps the imports used no matter which literals the program contains
+	printf("var _ = math.Float64frombits\n\n")
+	printf("func mkInt(s string) *cxr.Int {\n")
+	printf("\tvar i cxr.Int\n")
+	printf("\ti.Value.SetString(s, 10)\n")
+	printf("\treturn &i\n")
+	printf("}\n")
+
+	// the generated code is only indented by gofmt
+	src, err := format.Source(buf.Bytes())
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(src)
+	return err
+}
+
+// generator translates the compiled expressions, which have all their abstractions closed,
+// to Go. Abstractions become Go functions, whose arguments are the parameters, and everything
+// that doesn't depend on them becomes a package variable.
+type generator struct {
+	env *compile.Env
+
+	globals     map[string][]string
+	globalNames []string
+	constNames  []string
+	numFuncs    int
+
+	consts strings.Builder
+	init   strings.Builder
+	funcs  strings.Builder
+}
+
+func (gen *generator) global(name string, index int, e crux.Expr) {
+	global := gen.globals[name][index]
+	fmt.Fprintf(&gen.init, "\t// %s/%d at %v\n", name, index, gen.env.SourceInfo(name, index))
+	if abst, ok := e.(*crux.Abst); ok {
+		fmt.Fprintf(&gen.init, "\t%s = native.Func(%d, %s)\n", global, len(abst.Bound), gen.function(abst))
+		return
+	}
+	// evaluated at most once, just like crux's globals
+	var body strings.Builder
+	gen.tail(&body, nil, e)
+	fmt.Fprintf(&gen.init, "\t%s = native.Lazy(func() cxr.Value {\n%s})\n", global, body.String())
+}
+
+// constant makes a package variable of the value
+func (gen *generator) constant(value string) string {
+	name := fmt.Sprintf("c%d", len(gen.constNames))
+	gen.constNames = append(gen.constNames, name)
+	fmt.Fprintf(&gen.consts, "\t%s = %s\n", name, value)
+	return name
+}
+
+// function makes a Go function of the closed abstraction and returns its name
+func (gen *generator) function(abst *crux.Abst) string {
+	name := fmt.Sprintf("fn%d", gen.numFuncs)
+	gen.numFuncs++
+
+	// the last one of parameters with the same name wins
+	locals := make(map[string]string)
+	for i, bound := range abst.Bound {
+		locals[bound] = fmt.Sprintf("args[%d]", i)
+	}
+
+	var body strings.Builder
+	gen.tail(&body, locals, abst.Body)
+	fmt.Fprintf(&gen.funcs, "\nfunc %s(args []cxr.Value) cxr.Value {\n%s}\n", name, body.String())
+	return name
+}
+
+// tail writes the statements returning the value of the expression, which may be unevaluated
+func (gen *generator) tail(b *strings.Builder, locals map[string]string, e crux.Expr) {
+	switch e := e.(type) {
+	case *crux.Appl:
+		fmt.Fprintf(b, "return %s\n", gen.appl(locals, e))
+
+	case *crux.Strict:
+		gen.tail(b, locals, e.Expr)
+
+	case *crux.Switch:
+		fmt.Fprintf(b, "switch str := native.Struct(%s); str.Index {\n", gen.lazy(locals, e.Expr))
+		for i, cas := range e.Cases {
+			fmt.Fprintf(b, "case %d:\n", i)
+			fmt.Fprintf(b, "return native.ApplyFields(%s, str)\n", gen.lazy(locals, cas))
+		}
+		fmt.Fprintf(b, "}\n")
+		fmt.Fprintf(b, "panic(\"unreachable\")\n")
+
+	default:
+		fmt.Fprintf(b, "return %s\n", gen.lazy(locals, e))
+	}
+}
+
+// appl returns the Go expression of the application, which evaluates its strict arguments
+func (gen *generator) appl(locals map[string]string, e *crux.Appl) string {
+	args := []string{gen.lazy(locals, e.Rator)}
+	for _, rand := range e.Rands {
+		if strict, ok := rand.(*crux.Strict); ok {
+			args = append(args, fmt.Sprintf("native.Force(%s)", gen.lazy(locals, strict.Expr)))
+			continue
+		}
+		args = append(args, gen.lazy(locals, rand))
+	}
+	return fmt.Sprintf("native.Apply(%s)", strings.Join(args, ", "))
+}
+
+// lazy returns the Go expression of the unevaluated value of the expression
+func (gen *generator) lazy(locals map[string]string, e crux.Expr) string {
+	switch e := e.(type) {
+	case *crux.Char:
+		return gen.constant(fmt.Sprintf("&cxr.Char{Value: %q}", e.Value))
+	case *crux.Int:
+		return gen.constant(fmt.Sprintf("mkInt(%q)", e.Value.String()))
+	case *crux.Float:
+		return gen.constant(fmt.Sprintf("&cxr.Float{Value: math.Float64frombits(%#x)}", math.Float64bits(e.Value)))
+	case *crux.Operator:
+		return gen.constant(fmt.Sprintf("native.Operator(%d, %d)", e.Code, gen.env.OperatorArity(e.Code)))
+	case *crux.Make:
+		return gen.constant(fmt.Sprintf("native.Make(%d)", e.Index))
+	case *crux.Field:
+		return gen.constant(fmt.Sprintf("native.Field(%d)", e.Index))
+
+	case *crux.Var:
+		if e.Index >= 0 {
+			return gen.globals[e.Name][e.Index]
+		}
+		return locals[e.Name]
+
+	case *crux.Abst:
+		return gen.constant(fmt.Sprintf("native.Func(%d, %s)", len(e.Bound), gen.function(e)))
+
+	case *crux.Appl:
+		for _, rand := range e.Rands {
+			if _, ok := rand.(*crux.Strict); ok {
+				// the strict arguments get evaluated when the application does
+				return fmt.Sprintf("native.Lazy(func() cxr.Value { return %s })", gen.appl(locals, e))
+			}
+		}
+		return gen.appl(locals, e)
+
+	case *crux.Strict:
+		return gen.lazy(locals, e.Expr)
+
+	case *crux.Switch:
+		var body strings.Builder
+		gen.tail(&body, locals, e)
+		return fmt.Sprintf("native.Lazy(func() cxr.Value {\n%s})", body.String())
+
+	default:
+		panic("unreachable")
+	}
+}
@@ -0,0 +1,77 @@
+package funky
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+
+	"github.com/faiface/funky/interpreters/funkycmd/driver"
+	"github.com/faiface/funky/runtime"
+)
+
+// TestBuild runs the transcripts of the examples built by -build and compares the outputs
+// with the ones of the compiled programs.
+func TestBuild(t *testing.T) {
+	if testing.Short() {
+		t.Skip("builds Go programs")
+	}
+	goCmd, err := exec.LookPath("go")
+	if err != nil {
+		t.Skip("no go command")
+	}
+
+	// inside the module, so that the generated programs can import its packages, and starting
+	// with _, so that the go command ignores it otherwise
+	dir, err := ioutil.TempDir(".", "_build")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for _, name := range transcripts(t) {
+		t.Run(name, func(t *testing.T) {
+			input, err := ioutil.ReadFile(filepath.Join("examples", "testdata", name+".in"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			env := exampleEnv(t, name)
+
+			prog, errs := compileProgram(env, "main")
+			for _, err := range errs {
+				t.Fatal(err)
+			}
+			var compiled bytes.Buffer
+			program := runtime.NewProgram(prog.globalValues).Global(prog.globalIndices["main"][0])
+			if err := driver.Run(program, bytes.NewReader(input), &compiled); err != nil {
+				t.Fatal(err)
+			}
+
+			pkg := filepath.Join(dir, name)
+			if err := os.Mkdir(pkg, 0777); err != nil {
+				t.Fatal(err)
+			}
+			if err := buildProgram(filepath.Join(pkg, "main.go"), env, "main"); err != nil {
+				t.Fatal(err)
+			}
+			binary := filepath.Join(pkg, name)
+			if out, err := exec.Command(goCmd, "build", "-o", binary, "./"+pkg).CombinedOutput(); err != nil {
+				t.Fatalf("go build: %v\n%s", err, out)
+			}
+			var built bytes.Buffer
+			cmd := exec.Command(binary)
+			cmd.Stdin = bytes.NewReader(input)
+			cmd.Stdout = &built
+			cmd.Stderr = os.Stderr
+			if err := cmd.Run(); err != nil {
+				t.Fatal(err)
+			}
+
+			if built.String() != compiled.String() {
+				t.Errorf("outputs differ\n%s", firstDifference(compiled.String(), built.String()))
+			}
+		})
+	}
+}
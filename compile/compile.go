@@ -1,34 +1,281 @@
 package compile
 
 import (
+	"fmt"
+	"sort"
+
 	"github.com/faiface/crux"
 	"github.com/faiface/crux/runtime"
 	"github.com/faiface/funky/expr"
+	"github.com/faiface/funky/parse/parseinfo"
 	"github.com/faiface/funky/types/typecheck"
 )
 
-func (env *Env) Compile(main string) (
+type Stats struct {
+	Definitions int // number of all definitions, including the built-in ones
+	Pruned      int // number of definitions unreachable from the roots
+	Inlined     int // number of inlined references to functions
+	BetaReduced int // number of parameters substituted by their arguments
+	KnownCases  int // number of switches and field accesses on known constructors eliminated
+	Folded      int // number of operator applications evaluated at compile time
+	Strictified int // number of arguments evaluated strictly thanks to strictness analysis
+}
+
+func (env *Env) Stats() Stats { return env.stats }
+
+// Compile only compiles definitions reachable from the roots, usually just main. Returned
+// globalIndices and codeIndices are indexed by overloads in the Env and contain -1 for the
+// unreachable ones.
+func (env *Env) Compile(roots ...string) (
 	globalIndices map[string][]int32,
 	globalValues []runtime.Value,
 	codeIndices map[string][]int32,
 	codes []runtime.Code,
+	sources *SourceTable,
+	errs []error,
 ) {
-	env.lazyInit()
+	reachable, compiled, errs := env.compileReachable(roots)
+	if len(errs) > 0 {
+		return nil, nil, nil, nil, nil, errs
+	}
+
+	// unreachable overloads are left out, so the reachable ones get new indices
+	newIndices := make(map[string]map[int]int32)
+	for name, indices := range reachable {
+		newIndices[name] = make(map[int]int32)
+		for newIndex, index := range indices {
+			newIndices[name][index] = int32(newIndex)
+		}
+	}
 
 	globals := make(map[string][]crux.Expr)
+	for name, indices := range reachable {
+		for _, index := range indices {
+			renumbered := mapVars(compiled[global{name, index}], func(v *crux.Var) crux.Expr {
+				if v.Index < 0 {
+					return v
+				}
+				return &crux.Var{Name: v.Name, Index: newIndices[v.Name][int(v.Index)]}
+			})
+			globals[name] = append(globals[name], renumbered)
+		}
+	}
+
+	var newGlobalIndices, newCodeIndices map[string][]int32
+	func() {
+		defer env.catch(nil)
+		newGlobalIndices, globalValues, newCodeIndices, codes = crux.Compile(globals)
+	}()
+	if len(env.errs) > 0 {
+		return nil, nil, nil, nil, nil, env.takeErrs()
+	}
+
+	globalIndices = make(map[string][]int32)
+	codeIndices = make(map[string][]int32)
+	for name, indices := range reachable {
+		globalIndices[name] = make([]int32, len(env.funcs[name]))
+		codeIndices[name] = make([]int32, len(env.funcs[name]))
+		for i := range globalIndices[name] {
+			globalIndices[name][i] = -1
+			codeIndices[name][i] = -1
+		}
+		for newIndex, index := range indices {
+			globalIndices[name][index] = newGlobalIndices[name][newIndex]
+			codeIndices[name][index] = newCodeIndices[name][newIndex]
+		}
+	}
+
+	sourceInfos := make(map[string][]*parseinfo.Source)
+	for name := range globalIndices {
+		for i := range globalIndices[name] {
+			sourceInfos[name] = append(sourceInfos[name], env.SourceInfo(name, i))
+		}
+	}
+	sources = NewSourceTable(globalIndices, codeIndices, codes, sourceInfos)
+
+	return globalIndices, globalValues, codeIndices, codes, sources, nil
+}
+
+// Exprs compiles the definitions reachable from the roots to the expressions Compile turns into codes.
+// The expressions are indexed by overloads in the Env, just like the global variables in them,
+// and nil for the unreachable overloads.
+func (env *Env) Exprs(roots ...string) (exprs map[string][]crux.Expr, errs []error) {
+	reachable, compiled, errs := env.compileReachable(roots)
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	exprs = make(map[string][]crux.Expr)
+	for name, indices := range reachable {
+		exprs[name] = make([]crux.Expr, len(env.funcs[name]))
+		for _, index := range indices {
+			exprs[name][index] = compiled[global{name, index}]
+		}
+	}
+	return exprs, nil
+}
+
+// OperatorArity returns the number of arguments the operator takes.
+func (env *Env) OperatorArity(code int32) int {
+	env.lazyInit()
+	return env.operatorArities[code]
+}
+
+// compileReachable compiles the overloads reachable from the roots, which it returns sorted
+func (env *Env) compileReachable(roots []string) (reachable map[string][]int, compiled map[global]crux.Expr, errs []error) {
+	env.lazyInit()
+
+	if len(env.initErrs) > 0 {
+		return nil, nil, env.initErrs
+	}
+	env.errs = nil
+
+	reachable = env.reachable(roots)
 
-	for name, impls := range env.funcs {
-		for i := range impls {
-			switch impl := impls[i].(type) {
-			case *internal:
-				globals[name] = append(globals[name], impl.Expr)
-			case *function:
-				globals[name] = append(globals[name], compress(lift(nil, compress(env.translate(nil, impl.Expr)))))
+	// optimization counts are accumulated as the functions get compiled
+	env.stats.Definitions, env.stats.Pruned, env.stats.Strictified = 0, 0, 0
+	for name := range env.funcs {
+		env.stats.Definitions += len(env.funcs[name])
+		env.stats.Pruned += len(env.funcs[name]) - len(reachable[name])
+	}
+
+	compiled = make(map[global]crux.Expr)
+	for name, indices := range reachable {
+		for _, index := range indices {
+			compiled[global{name, index}] = env.compileFunc(name, index)
+		}
+	}
+	if !env.Options.NoStrictness {
+		func() {
+			defer env.catch(nil)
+			env.strictify(compiled)
+		}()
+	}
+	if len(env.errs) > 0 {
+		return nil, nil, env.takeErrs()
+	}
+	return reachable, compiled, nil
+}
+
+// catch turns a panic into an error, so that a bug in the compiler doesn't take down its user
+func (env *Env) catch(si *parseinfo.Source) {
+	if r := recover(); r != nil {
+		env.errs = append(env.errs, &Error{si, fmt.Sprintf("internal compiler error: %v", r)})
+	}
+}
+
+// takeErrs returns the errors of the current compilation without duplicates, which come from
+// inlined functions
+func (env *Env) takeErrs() []error {
+	var errs []error
+	seen := make(map[string]bool)
+	for _, err := range env.errs {
+		if !seen[err.Error()] {
+			seen[err.Error()] = true
+			errs = append(errs, err)
+		}
+	}
+	env.errs = nil
+	return errs
+}
+
+// compileFunc returns a placeholder if the compilation fails, the errors are in env.errs
+func (env *Env) compileFunc(name string, index int) (compiled crux.Expr) {
+	for len(env.compiled[name]) < len(env.funcs[name]) {
+		env.compiled[name] = append(env.compiled[name], nil)
+	}
+	if env.compiled[name][index] != nil {
+		return env.compiled[name][index]
+	}
+
+	numErrs := len(env.errs)
+	defer func() {
+		if len(env.errs) > numErrs {
+			compiled = &crux.Char{}
+			return
+		}
+		env.compiled[name][index] = compiled
+	}()
+	defer env.catch(env.SourceInfo(name, index))
+
+	switch impl := env.funcs[name][index].(type) {
+	case *internal:
+		compiled = impl.Expr
+	case *function:
+		compiled = compress(lift(nil, env.optimize(compress(env.translate(nil, impl.Expr)))))
+	}
+	return compiled
+}
+
+// reachable returns sorted indices of overloads reachable from the roots
+func (env *Env) reachable(roots []string) map[string][]int {
+	var (
+		seen  = make(map[global]bool)
+		queue []global
+	)
+
+	for _, root := range roots {
+		for i := range env.funcs[root] {
+			if !seen[global{root, i}] {
+				seen[global{root, i}] = true
+				queue = append(queue, global{root, i})
 			}
 		}
 	}
 
-	return crux.Compile(globals)
+	for len(queue) > 0 {
+		g := queue[0]
+		queue = queue[1:]
+		mapVars(env.compileFunc(g.Name, g.Index), func(v *crux.Var) crux.Expr {
+			used := global{v.Name, int(v.Index)}
+			if v.Index >= 0 && !seen[used] {
+				seen[used] = true
+				queue = append(queue, used)
+			}
+			return v
+		})
+	}
+
+	reachable := make(map[string][]int)
+	for g := range seen {
+		reachable[g.Name] = append(reachable[g.Name], g.Index)
+	}
+	for name := range reachable {
+		sort.Ints(reachable[name])
+	}
+	return reachable
+}
+
+func mapVars(e crux.Expr, f func(*crux.Var) crux.Expr) crux.Expr {
+	switch e := e.(type) {
+	case *crux.Char, *crux.Int, *crux.Float, *crux.Operator, *crux.Make, *crux.Field:
+		return e
+
+	case *crux.Var:
+		return f(e)
+
+	case *crux.Abst:
+		return &crux.Abst{Bound: e.Bound, Body: mapVars(e.Body, f)}
+
+	case *crux.Appl:
+		mappedRands := make([]crux.Expr, len(e.Rands))
+		for i := range mappedRands {
+			mappedRands[i] = mapVars(e.Rands[i], f)
+		}
+		return &crux.Appl{Rator: mapVars(e.Rator, f), Rands: mappedRands}
+
+	case *crux.Strict:
+		return &crux.Strict{Expr: mapVars(e.Expr, f)}
+
+	case *crux.Switch:
+		mappedCases := make([]crux.Expr, len(e.Cases))
+		for i := range mappedCases {
+			mappedCases[i] = mapVars(e.Cases[i], f)
+		}
+		return &crux.Switch{Expr: mapVars(e.Expr, f), Cases: mappedCases}
+
+	default:
+		panic("unreachable")
+	}
 }
 
 func (env *Env) translate(locals []string, e expr.Expr) crux.Expr {
@@ -45,20 +292,23 @@ func (env *Env) translate(locals []string, e expr.Expr) crux.Expr {
 		return &crux.Float{Value: e.Value}
 
 	case *expr.Var:
-		for _, local := range locals {
-			if local == e.Name {
-				return &crux.Var{Name: e.Name, Index: -1}
-			}
+		index, ok := env.resolve(locals, e)
+		if !ok {
+			env.errs = append(env.errs, &Error{e.SourceInfo(), fmt.Sprintf("unknown variable: %s", e.Name)})
+			return &crux.Var{Name: e.Name, Index: -1}
 		}
-		for i, impl := range env.funcs[e.Name] {
-			if typecheck.CheckIfUnify(env.names, e.TypeInfo(), impl.TypeInfo()) {
-				return &crux.Var{
-					Name:  e.Name,
-					Index: int32(i),
+		if index >= 0 {
+			if impl, ok := env.funcs[e.Name][index].(*internal); ok {
+				if op, ok := impl.Expr.(*crux.Operator); ok && op.Code == runtime.OpError {
+					return locatePanic(e.SourceInfo(), op)
 				}
 			}
 		}
-		panic("unknown variable")
+		return &crux.Var{Name: e.Name, Index: index}
+
+	case *expr.Hole:
+		env.errs = append(env.errs, &Error{e.SourceInfo(), fmt.Sprintf("hole %s", e.Name)})
+		return &crux.Var{Name: e.Name, Index: -1}
 
 	case *expr.Abst:
 		return &crux.Abst{
@@ -90,6 +340,21 @@ func (env *Env) translate(locals []string, e expr.Expr) crux.Expr {
 	}
 }
 
+// resolve returns the index of the overload the variable refers to, or -1 if it's local
+func (env *Env) resolve(locals []string, v *expr.Var) (index int32, ok bool) {
+	for _, local := range locals {
+		if local == v.Name {
+			return -1, true
+		}
+	}
+	for i, impl := range env.funcs[v.Name] {
+		if typecheck.CheckIfUnify(env.names, v.TypeInfo(), impl.TypeInfo()) {
+			return int32(i), true
+		}
+	}
+	return 0, false
+}
+
 func compress(e crux.Expr) crux.Expr {
 	switch e := e.(type) {
 	case *crux.Char, *crux.Int, *crux.Float, *crux.Operator, *crux.Make, *crux.Field, *crux.Var:
@@ -0,0 +1,60 @@
+package compile
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestReachable(t *testing.T) {
+	env := checkedEnv(t, testPrelude+`
+func describe : Int -> Int = \x x + 1
+func describe : Char -> Int = \c 0
+func describe : Bool -> Int = \b 1
+
+func helper : Int -> Int = \x describe x
+func main : Int = helper 1
+
+func unused : Int = describe 'a'
+func also-unused : Int -> Int = \x unused
+`)
+	env.Options.NoInline = true
+
+	reachable := env.reachable([]string{"main"})
+	for _, name := range []string{"unused", "also-unused"} {
+		if len(reachable[name]) > 0 {
+			t.Errorf("%s is reachable", name)
+		}
+	}
+	if len(reachable["main"]) != 1 || len(reachable["helper"]) != 1 {
+		t.Errorf("main and helper aren't reachable: %v", reachable)
+	}
+	// only the Int overload is used through helper
+	var intOverload int
+	for i, imp := range env.funcs["describe"] {
+		if imp.TypeInfo().String() == "Int -> Int" {
+			intOverload = i
+		}
+	}
+	if !reflect.DeepEqual(reachable["describe"], []int{intOverload}) {
+		t.Errorf("got describe overloads %v, want [%d]", reachable["describe"], intOverload)
+	}
+
+	_, _, _, _, _, errs := env.Compile("main")
+	for _, err := range errs {
+		t.Fatal(err)
+	}
+	if kept := env.Stats().Definitions - env.Stats().Pruned; kept != reachableCount(env.reachable([]string{"main"})) {
+		t.Errorf("got %d definitions and %d pruned, want all but the reachable ones pruned", env.Stats().Definitions, env.Stats().Pruned)
+	}
+	if env.Stats().Pruned < 4 {
+		t.Errorf("pruned %d definitions, want at least unused, also-unused and two overloads of describe", env.Stats().Pruned)
+	}
+}
+
+func reachableCount(reachable map[string][]int) int {
+	n := 0
+	for _, indices := range reachable {
+		n += len(indices)
+	}
+	return n
+}
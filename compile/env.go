@@ -23,9 +23,17 @@ func (err *Error) Error() string {
 }
 
 type Env struct {
-	inited bool
-	names  map[string]types.Name
-	funcs  map[string][]funcImpl
+	Options Options
+
+	inited   bool
+	names    map[string]types.Name
+	funcs    map[string][]funcImpl
+	compiled map[string][]crux.Expr
+	stats    Stats
+
+	operatorArities map[int32]int
+	initErrs        []error
+	errs            []error // errors of the current compilation
 }
 
 type funcImpl interface {
@@ -50,16 +58,18 @@ func (f *function) SourceInfo() *parseinfo.Source { return f.Expr.SourceInfo() }
 func (i *internal) TypeInfo() types.Type          { return i.Type }
 func (f *function) TypeInfo() types.Type          { return f.Expr.TypeInfo() }
 
-func parseType(s string) types.Type {
+// parseType parses signatures of built-in functions, failures are reported by Compile
+func (env *Env) parseType(s string) types.Type {
 	tokens, err := parse.Tokenize("", s)
-	if err != nil {
-		panic(err)
-	}
-	typ, err := parse.Type(tokens)
-	if err != nil {
-		panic(err)
+	if err == nil {
+		var typ types.Type
+		typ, err = parse.Type(tokens)
+		if err == nil {
+			return typ
+		}
 	}
-	return typ
+	env.initErrs = append(env.initErrs, &Error{nil, fmt.Sprintf("invalid built-in type %q: %v", s, err)})
+	return &types.Var{Name: "a"}
 }
 
 func (env *Env) lazyInit() {
@@ -76,109 +86,113 @@ func (env *Env) lazyInit() {
 	}
 
 	env.funcs = make(map[string][]funcImpl)
+	env.compiled = make(map[string][]crux.Expr)
+	env.operatorArities = make(map[int32]int)
 
 	// built-in operator functions
 
 	// Char
-	env.addFunc("int", &internal{Type: parseType("Char -> Int"), Expr: mk.Op(runtime.OpCharInt)})
-	env.addFunc("inc", &internal{Type: parseType("Char -> Char"), Expr: mk.Op(runtime.OpCharInc)})
-	env.addFunc("dec", &internal{Type: parseType("Char -> Char"), Expr: mk.Op(runtime.OpCharDec)})
-	env.addFunc("+", &internal{Type: parseType("Char -> Int -> Char"), Expr: mk.Op(runtime.OpCharAdd)})
-	env.addFunc("-", &internal{Type: parseType("Char -> Int -> Char"), Expr: mk.Op(runtime.OpCharSub)})
-	env.addFunc("==", &internal{Type: parseType("Char -> Char -> Bool"), Expr: mk.Op(runtime.OpCharEq)})
-	env.addFunc("!=", &internal{Type: parseType("Char -> Char -> Bool"), Expr: mk.Op(runtime.OpCharNeq)})
-	env.addFunc("<", &internal{Type: parseType("Char -> Char -> Bool"), Expr: mk.Op(runtime.OpCharLess)})
-	env.addFunc("<=", &internal{Type: parseType("Char -> Char -> Bool"), Expr: mk.Op(runtime.OpCharLessEq)})
-	env.addFunc(">", &internal{Type: parseType("Char -> Char -> Bool"), Expr: mk.Op(runtime.OpCharMore)})
-	env.addFunc(">=", &internal{Type: parseType("Char -> Char -> Bool"), Expr: mk.Op(runtime.OpCharMoreEq)})
-	env.addFunc("upper", &internal{Type: parseType("Char -> Char"), Expr: mk.Op(runtime.OpCharToUpper)})
-	env.addFunc("lower", &internal{Type: parseType("Char -> Char"), Expr: mk.Op(runtime.OpCharToLower)})
-	env.addFunc("whitespace?", &internal{Type: parseType("Char -> Bool"), Expr: mk.Op(runtime.OpCharIsWhitespace)})
-	env.addFunc("letter?", &internal{Type: parseType("Char -> Bool"), Expr: mk.Op(runtime.OpCharIsLetter)})
-	env.addFunc("digit?", &internal{Type: parseType("Char -> Bool"), Expr: mk.Op(runtime.OpCharIsDigit)})
-	env.addFunc("upper?", &internal{Type: parseType("Char -> Bool"), Expr: mk.Op(runtime.OpCharIsUpper)})
-	env.addFunc("lower?", &internal{Type: parseType("Char -> Bool"), Expr: mk.Op(runtime.OpCharIsLower)})
-	env.addFunc("ascii?", &internal{Type: parseType("Char -> Bool"), Expr: mk.Op(runtime.OpCharIsASCII)})
+	env.addFunc("int", &internal{Type: env.parseType("Char -> Int"), Expr: mk.Op(runtime.OpCharInt)})
+	env.addFunc("inc", &internal{Type: env.parseType("Char -> Char"), Expr: mk.Op(runtime.OpCharInc)})
+	env.addFunc("dec", &internal{Type: env.parseType("Char -> Char"), Expr: mk.Op(runtime.OpCharDec)})
+	env.addFunc("+", &internal{Type: env.parseType("Char -> Int -> Char"), Expr: mk.Op(runtime.OpCharAdd)})
+	env.addFunc("-", &internal{Type: env.parseType("Char -> Int -> Char"), Expr: mk.Op(runtime.OpCharSub)})
+	env.addFunc("==", &internal{Type: env.parseType("Char -> Char -> Bool"), Expr: mk.Op(runtime.OpCharEq)})
+	env.addFunc("!=", &internal{Type: env.parseType("Char -> Char -> Bool"), Expr: mk.Op(runtime.OpCharNeq)})
+	env.addFunc("<", &internal{Type: env.parseType("Char -> Char -> Bool"), Expr: mk.Op(runtime.OpCharLess)})
+	env.addFunc("<=", &internal{Type: env.parseType("Char -> Char -> Bool"), Expr: mk.Op(runtime.OpCharLessEq)})
+	env.addFunc(">", &internal{Type: env.parseType("Char -> Char -> Bool"), Expr: mk.Op(runtime.OpCharMore)})
+	env.addFunc(">=", &internal{Type: env.parseType("Char -> Char -> Bool"), Expr: mk.Op(runtime.OpCharMoreEq)})
+	env.addFunc("upper", &internal{Type: env.parseType("Char -> Char"), Expr: mk.Op(runtime.OpCharToUpper)})
+	env.addFunc("lower", &internal{Type: env.parseType("Char -> Char"), Expr: mk.Op(runtime.OpCharToLower)})
+	env.addFunc("whitespace?", &internal{Type: env.parseType("Char -> Bool"), Expr: mk.Op(runtime.OpCharIsWhitespace)})
+	env.addFunc("letter?", &internal{Type: env.parseType("Char -> Bool"), Expr: mk.Op(runtime.OpCharIsLetter)})
+	env.addFunc("digit?", &internal{Type: env.parseType("Char -> Bool"), Expr: mk.Op(runtime.OpCharIsDigit)})
+	env.addFunc("upper?", &internal{Type: env.parseType("Char -> Bool"), Expr: mk.Op(runtime.OpCharIsUpper)})
+	env.addFunc("lower?", &internal{Type: env.parseType("Char -> Bool"), Expr: mk.Op(runtime.OpCharIsLower)})
+	env.addFunc("ascii?", &internal{Type: env.parseType("Char -> Bool"), Expr: mk.Op(runtime.OpCharIsASCII)})
 
 	// Int
-	env.addFunc("char", &internal{Type: parseType("Int -> Char"), Expr: mk.Op(runtime.OpIntChar)})
-	env.addFunc("float", &internal{Type: parseType("Int -> Float"), Expr: mk.Op(runtime.OpIntFloat)})
-	env.addFunc("string", &internal{Type: parseType("Int -> String"), Expr: mk.Op(runtime.OpIntString)})
-	env.addFunc("neg", &internal{Type: parseType("Int -> Int"), Expr: mk.Op(runtime.OpIntNeg)})
-	env.addFunc("abs", &internal{Type: parseType("Int -> Int"), Expr: mk.Op(runtime.OpIntAbs)})
-	env.addFunc("inc", &internal{Type: parseType("Int -> Int"), Expr: mk.Op(runtime.OpIntInc)})
-	env.addFunc("dec", &internal{Type: parseType("Int -> Int"), Expr: mk.Op(runtime.OpIntDec)})
-	env.addFunc("+", &internal{Type: parseType("Int -> Int -> Int"), Expr: mk.Op(runtime.OpIntAdd)})
-	env.addFunc("-", &internal{Type: parseType("Int -> Int -> Int"), Expr: mk.Op(runtime.OpIntSub)})
-	env.addFunc("*", &internal{Type: parseType("Int -> Int -> Int"), Expr: mk.Op(runtime.OpIntMul)})
-	env.addFunc("/", &internal{Type: parseType("Int -> Int -> Int"), Expr: mk.Op(runtime.OpIntDiv)})
-	env.addFunc("%", &internal{Type: parseType("Int -> Int -> Int"), Expr: mk.Op(runtime.OpIntMod)})
-	env.addFunc("^", &internal{Type: parseType("Int -> Int -> Int"), Expr: mk.Op(runtime.OpIntExp)})
-	env.addFunc("==", &internal{Type: parseType("Int -> Int -> Bool"), Expr: mk.Op(runtime.OpIntEq)})
-	env.addFunc("!=", &internal{Type: parseType("Int -> Int -> Bool"), Expr: mk.Op(runtime.OpIntNeq)})
-	env.addFunc("<", &internal{Type: parseType("Int -> Int -> Bool"), Expr: mk.Op(runtime.OpIntLess)})
-	env.addFunc("<=", &internal{Type: parseType("Int -> Int -> Bool"), Expr: mk.Op(runtime.OpIntLessEq)})
-	env.addFunc(">", &internal{Type: parseType("Int -> Int -> Bool"), Expr: mk.Op(runtime.OpIntMore)})
-	env.addFunc(">=", &internal{Type: parseType("Int -> Int -> Bool"), Expr: mk.Op(runtime.OpIntMoreEq)})
-	env.addFunc("zero?", &internal{Type: parseType("Int -> Bool"), Expr: mk.Op(runtime.OpIntIsZero)})
+	env.addFunc("char", &internal{Type: env.parseType("Int -> Char"), Expr: mk.Op(runtime.OpIntChar)})
+	env.addFunc("float", &internal{Type: env.parseType("Int -> Float"), Expr: mk.Op(runtime.OpIntFloat)})
+	env.addFunc("string", &internal{Type: env.parseType("Int -> String"), Expr: mk.Op(runtime.OpIntString)})
+	env.addFunc("neg", &internal{Type: env.parseType("Int -> Int"), Expr: mk.Op(runtime.OpIntNeg)})
+	env.addFunc("abs", &internal{Type: env.parseType("Int -> Int"), Expr: mk.Op(runtime.OpIntAbs)})
+	env.addFunc("inc", &internal{Type: env.parseType("Int -> Int"), Expr: mk.Op(runtime.OpIntInc)})
+	env.addFunc("dec", &internal{Type: env.parseType("Int -> Int"), Expr: mk.Op(runtime.OpIntDec)})
+	env.addFunc("+", &internal{Type: env.parseType("Int -> Int -> Int"), Expr: mk.Op(runtime.OpIntAdd)})
+	env.addFunc("-", &internal{Type: env.parseType("Int -> Int -> Int"), Expr: mk.Op(runtime.OpIntSub)})
+	env.addFunc("*", &internal{Type: env.parseType("Int -> Int -> Int"), Expr: mk.Op(runtime.OpIntMul)})
+	env.addFunc("/", &internal{Type: env.parseType("Int -> Int -> Int"), Expr: mk.Op(runtime.OpIntDiv)})
+	env.addFunc("%", &internal{Type: env.parseType("Int -> Int -> Int"), Expr: mk.Op(runtime.OpIntMod)})
+	env.addFunc("^", &internal{Type: env.parseType("Int -> Int -> Int"), Expr: mk.Op(runtime.OpIntExp)})
+	env.addFunc("==", &internal{Type: env.parseType("Int -> Int -> Bool"), Expr: mk.Op(runtime.OpIntEq)})
+	env.addFunc("!=", &internal{Type: env.parseType("Int -> Int -> Bool"), Expr: mk.Op(runtime.OpIntNeq)})
+	env.addFunc("<", &internal{Type: env.parseType("Int -> Int -> Bool"), Expr: mk.Op(runtime.OpIntLess)})
+	env.addFunc("<=", &internal{Type: env.parseType("Int -> Int -> Bool"), Expr: mk.Op(runtime.OpIntLessEq)})
+	env.addFunc(">", &internal{Type: env.parseType("Int -> Int -> Bool"), Expr: mk.Op(runtime.OpIntMore)})
+	env.addFunc(">=", &internal{Type: env.parseType("Int -> Int -> Bool"), Expr: mk.Op(runtime.OpIntMoreEq)})
+	env.addFunc("zero?", &internal{Type: env.parseType("Int -> Bool"), Expr: mk.Op(runtime.OpIntIsZero)})
 
 	// Float
-	env.addFunc("int", &internal{Type: parseType("Float -> Int"), Expr: mk.Op(runtime.OpFloatInt)})
-	env.addFunc("string", &internal{Type: parseType("Float -> String"), Expr: mk.Op(runtime.OpFloatString)})
-	env.addFunc("neg", &internal{Type: parseType("Float -> Float"), Expr: mk.Op(runtime.OpFloatNeg)})
-	env.addFunc("abs", &internal{Type: parseType("Float -> Float"), Expr: mk.Op(runtime.OpFloatAbs)})
-	env.addFunc("inc", &internal{Type: parseType("Float -> Float"), Expr: mk.Op(runtime.OpFloatInc)})
-	env.addFunc("dec", &internal{Type: parseType("Float -> Float"), Expr: mk.Op(runtime.OpFloatDec)})
-	env.addFunc("+", &internal{Type: parseType("Float -> Float -> Float"), Expr: mk.Op(runtime.OpFloatAdd)})
-	env.addFunc("-", &internal{Type: parseType("Float -> Float -> Float"), Expr: mk.Op(runtime.OpFloatSub)})
-	env.addFunc("*", &internal{Type: parseType("Float -> Float -> Float"), Expr: mk.Op(runtime.OpFloatMul)})
-	env.addFunc("/", &internal{Type: parseType("Float -> Float -> Float"), Expr: mk.Op(runtime.OpFloatDiv)})
-	env.addFunc("%", &internal{Type: parseType("Float -> Float -> Float"), Expr: mk.Op(runtime.OpFloatMod)})
-	env.addFunc("^", &internal{Type: parseType("Float -> Float -> Float"), Expr: mk.Op(runtime.OpFloatExp)})
-	env.addFunc("==", &internal{Type: parseType("Float -> Float -> Bool"), Expr: mk.Op(runtime.OpFloatEq)})
-	env.addFunc("!=", &internal{Type: parseType("Float -> Float -> Bool"), Expr: mk.Op(runtime.OpFloatNeq)})
-	env.addFunc("<", &internal{Type: parseType("Float -> Float -> Bool"), Expr: mk.Op(runtime.OpFloatLess)})
-	env.addFunc("<=", &internal{Type: parseType("Float -> Float -> Bool"), Expr: mk.Op(runtime.OpFloatLessEq)})
-	env.addFunc(">", &internal{Type: parseType("Float -> Float -> Bool"), Expr: mk.Op(runtime.OpFloatMore)})
-	env.addFunc(">=", &internal{Type: parseType("Float -> Float -> Bool"), Expr: mk.Op(runtime.OpFloatMoreEq)})
-	env.addFunc("+inf", &internal{Type: parseType("Float"), Expr: mk.Float(math.Inf(+1))})
-	env.addFunc("-inf", &internal{Type: parseType("Float"), Expr: mk.Float(math.Inf(-1))})
-	env.addFunc("nan", &internal{Type: parseType("Float"), Expr: mk.Float(math.NaN())})
-	env.addFunc("e", &internal{Type: parseType("Float"), Expr: mk.Float(math.E)})
-	env.addFunc("pi", &internal{Type: parseType("Float"), Expr: mk.Float(math.Pi)})
-	env.addFunc("phi", &internal{Type: parseType("Float"), Expr: mk.Float(math.Phi)})
-	env.addFunc("+inf?", &internal{Type: parseType("Float -> Bool"), Expr: mk.Op(runtime.OpFloatIsPlusInf)})
-	env.addFunc("-inf?", &internal{Type: parseType("Float -> Bool"), Expr: mk.Op(runtime.OpFloatIsMinusInf)})
-	env.addFunc("inf?", &internal{Type: parseType("Float -> Bool"), Expr: mk.Op(runtime.OpFloatIsInf)})
-	env.addFunc("nan?", &internal{Type: parseType("Float -> Bool"), Expr: mk.Op(runtime.OpFloatIsNan)})
-	env.addFunc("sin", &internal{Type: parseType("Float -> Float"), Expr: mk.Op(runtime.OpFloatSin)})
-	env.addFunc("cos", &internal{Type: parseType("Float -> Float"), Expr: mk.Op(runtime.OpFloatCos)})
-	env.addFunc("tan", &internal{Type: parseType("Float -> Float"), Expr: mk.Op(runtime.OpFloatTan)})
-	env.addFunc("asin", &internal{Type: parseType("Float -> Float"), Expr: mk.Op(runtime.OpFloatAsin)})
-	env.addFunc("acos", &internal{Type: parseType("Float -> Float"), Expr: mk.Op(runtime.OpFloatAcos)})
-	env.addFunc("atan", &internal{Type: parseType("Float -> Float"), Expr: mk.Op(runtime.OpFloatAtan)})
-	env.addFunc("atan2", &internal{Type: parseType("Float -> Float -> Float"), Expr: mk.Op(runtime.OpFloatAtan2)})
-	env.addFunc("sinh", &internal{Type: parseType("Float -> Float"), Expr: mk.Op(runtime.OpFloatSinh)})
-	env.addFunc("cosh", &internal{Type: parseType("Float -> Float"), Expr: mk.Op(runtime.OpFloatCosh)})
-	env.addFunc("tanh", &internal{Type: parseType("Float -> Float"), Expr: mk.Op(runtime.OpFloatTanh)})
-	env.addFunc("asinh", &internal{Type: parseType("Float -> Float"), Expr: mk.Op(runtime.OpFloatAsinh)})
-	env.addFunc("acosh", &internal{Type: parseType("Float -> Float"), Expr: mk.Op(runtime.OpFloatAcosh)})
-	env.addFunc("atanh", &internal{Type: parseType("Float -> Float"), Expr: mk.Op(runtime.OpFloatAtanh)})
-	env.addFunc("ceil", &internal{Type: parseType("Float -> Float"), Expr: mk.Op(runtime.OpFloatCeil)})
-	env.addFunc("floor", &internal{Type: parseType("Float -> Float"), Expr: mk.Op(runtime.OpFloatFloor)})
-	env.addFunc("sqrt", &internal{Type: parseType("Float -> Float"), Expr: mk.Op(runtime.OpFloatSqrt)})
-	env.addFunc("cbrt", &internal{Type: parseType("Float -> Float"), Expr: mk.Op(runtime.OpFloatCbrt)})
-	env.addFunc("log", &internal{Type: parseType("Float -> Float"), Expr: mk.Op(runtime.OpFloatLog)})
-	env.addFunc("hypot", &internal{Type: parseType("Float -> Float -> Float"), Expr: mk.Op(runtime.OpFloatHypot)})
-	env.addFunc("gamma", &internal{Type: parseType("Float -> Float"), Expr: mk.Op(runtime.OpFloatGamma)})
+	env.addFunc("int", &internal{Type: env.parseType("Float -> Int"), Expr: mk.Op(runtime.OpFloatInt)})
+	env.addFunc("string", &internal{Type: env.parseType("Float -> String"), Expr: mk.Op(runtime.OpFloatString)})
+	env.addFunc("neg", &internal{Type: env.parseType("Float -> Float"), Expr: mk.Op(runtime.OpFloatNeg)})
+	env.addFunc("abs", &internal{Type: env.parseType("Float -> Float"), Expr: mk.Op(runtime.OpFloatAbs)})
+	env.addFunc("inc", &internal{Type: env.parseType("Float -> Float"), Expr: mk.Op(runtime.OpFloatInc)})
+	env.addFunc("dec", &internal{Type: env.parseType("Float -> Float"), Expr: mk.Op(runtime.OpFloatDec)})
+	env.addFunc("+", &internal{Type: env.parseType("Float -> Float -> Float"), Expr: mk.Op(runtime.OpFloatAdd)})
+	env.addFunc("-", &internal{Type: env.parseType("Float -> Float -> Float"), Expr: mk.Op(runtime.OpFloatSub)})
+	env.addFunc("*", &internal{Type: env.parseType("Float -> Float -> Float"), Expr: mk.Op(runtime.OpFloatMul)})
+	env.addFunc("/", &internal{Type: env.parseType("Float -> Float -> Float"), Expr: mk.Op(runtime.OpFloatDiv)})
+	env.addFunc("%", &internal{Type: env.parseType("Float -> Float -> Float"), Expr: mk.Op(runtime.OpFloatMod)})
+	env.addFunc("^", &internal{Type: env.parseType("Float -> Float -> Float"), Expr: mk.Op(runtime.OpFloatExp)})
+	env.addFunc("==", &internal{Type: env.parseType("Float -> Float -> Bool"), Expr: mk.Op(runtime.OpFloatEq)})
+	env.addFunc("!=", &internal{Type: env.parseType("Float -> Float -> Bool"), Expr: mk.Op(runtime.OpFloatNeq)})
+	env.addFunc("<", &internal{Type: env.parseType("Float -> Float -> Bool"), Expr: mk.Op(runtime.OpFloatLess)})
+	env.addFunc("<=", &internal{Type: env.parseType("Float -> Float -> Bool"), Expr: mk.Op(runtime.OpFloatLessEq)})
+	env.addFunc(">", &internal{Type: env.parseType("Float -> Float -> Bool"), Expr: mk.Op(runtime.OpFloatMore)})
+	env.addFunc(">=", &internal{Type: env.parseType("Float -> Float -> Bool"), Expr: mk.Op(runtime.OpFloatMoreEq)})
+	env.addFunc("+inf", &internal{Type: env.parseType("Float"), Expr: mk.Float(math.Inf(+1))})
+	env.addFunc("-inf", &internal{Type: env.parseType("Float"), Expr: mk.Float(math.Inf(-1))})
+	env.addFunc("nan", &internal{Type: env.parseType("Float"), Expr: mk.Float(math.NaN())})
+	env.addFunc("e", &internal{Type: env.parseType("Float"), Expr: mk.Float(math.E)})
+	env.addFunc("pi", &internal{Type: env.parseType("Float"), Expr: mk.Float(math.Pi)})
+	env.addFunc("phi", &internal{Type: env.parseType("Float"), Expr: mk.Float(math.Phi)})
+	env.addFunc("+inf?", &internal{Type: env.parseType("Float -> Bool"), Expr: mk.Op(runtime.OpFloatIsPlusInf)})
+	env.addFunc("-inf?", &internal{Type: env.parseType("Float -> Bool"), Expr: mk.Op(runtime.OpFloatIsMinusInf)})
+	env.addFunc("inf?", &internal{Type: env.parseType("Float -> Bool"), Expr: mk.Op(runtime.OpFloatIsInf)})
+	env.addFunc("nan?", &internal{Type: env.parseType("Float -> Bool"), Expr: mk.Op(runtime.OpFloatIsNan)})
+	env.addFunc("sin", &internal{Type: env.parseType("Float -> Float"), Expr: mk.Op(runtime.OpFloatSin)})
+	env.addFunc("cos", &internal{Type: env.parseType("Float -> Float"), Expr: mk.Op(runtime.OpFloatCos)})
+	env.addFunc("tan", &internal{Type: env.parseType("Float -> Float"), Expr: mk.Op(runtime.OpFloatTan)})
+	env.addFunc("asin", &internal{Type: env.parseType("Float -> Float"), Expr: mk.Op(runtime.OpFloatAsin)})
+	env.addFunc("acos", &internal{Type: env.parseType("Float -> Float"), Expr: mk.Op(runtime.OpFloatAcos)})
+	env.addFunc("atan", &internal{Type: env.parseType("Float -> Float"), Expr: mk.Op(runtime.OpFloatAtan)})
+	env.addFunc("atan2", &internal{Type: env.parseType("Float -> Float -> Float"), Expr: mk.Op(runtime.OpFloatAtan2)})
+	env.addFunc("sinh", &internal{Type: env.parseType("Float -> Float"), Expr: mk.Op(runtime.OpFloatSinh)})
+	env.addFunc("cosh", &internal{Type: env.parseType("Float -> Float"), Expr: mk.Op(runtime.OpFloatCosh)})
+	env.addFunc("tanh", &internal{Type: env.parseType("Float -> Float"), Expr: mk.Op(runtime.OpFloatTanh)})
+	env.addFunc("asinh", &internal{Type: env.parseType("Float -> Float"), Expr: mk.Op(runtime.OpFloatAsinh)})
+	env.addFunc("acosh", &internal{Type: env.parseType("Float -> Float"), Expr: mk.Op(runtime.OpFloatAcosh)})
+	env.addFunc("atanh", &internal{Type: env.parseType("Float -> Float"), Expr: mk.Op(runtime.OpFloatAtanh)})
+	env.addFunc("ceil", &internal{Type: env.parseType("Float -> Float"), Expr: mk.Op(runtime.OpFloatCeil)})
+	env.addFunc("floor", &internal{Type: env.parseType("Float -> Float"), Expr: mk.Op(runtime.OpFloatFloor)})
+	env.addFunc("sqrt", &internal{Type: env.parseType("Float -> Float"), Expr: mk.Op(runtime.OpFloatSqrt)})
+	env.addFunc("cbrt", &internal{Type: env.parseType("Float -> Float"), Expr: mk.Op(runtime.OpFloatCbrt)})
+	env.addFunc("log", &internal{Type: env.parseType("Float -> Float"), Expr: mk.Op(runtime.OpFloatLog)})
+	env.addFunc("hypot", &internal{Type: env.parseType("Float -> Float -> Float"), Expr: mk.Op(runtime.OpFloatHypot)})
+	env.addFunc("gamma", &internal{Type: env.parseType("Float -> Float"), Expr: mk.Op(runtime.OpFloatGamma)})
 
 	// String
-	env.addFunc("int", &internal{Type: parseType("String -> Int"), Expr: mk.Op(runtime.OpStringInt)})
-	env.addFunc("float", &internal{Type: parseType("String -> Float"), Expr: mk.Op(runtime.OpStringFloat)})
+	env.addFunc("int", &internal{Type: env.parseType("String -> Int"), Expr: mk.Op(runtime.OpStringInt)})
+	env.addFunc("float", &internal{Type: env.parseType("String -> Float"), Expr: mk.Op(runtime.OpStringFloat)})
 
 	// miscellaneous
-	env.addFunc("panic", &internal{Type: parseType("String -> a"), Expr: mk.Op(runtime.OpError)})
-	env.addFunc("dump", &internal{Type: parseType("String -> a -> a"), Expr: mk.Op(runtime.OpDump)})
+	env.addFunc("panic", &internal{Type: env.parseType("String -> a"), Expr: mk.Op(runtime.OpError)})
+	env.addFunc("dump", &internal{Type: env.parseType("String -> a -> a"), Expr: mk.Op(runtime.OpDump)})
+	// par x y is y, native programs evaluate x in parallel, see native.Machine
+	env.addFunc("par", &internal{Type: env.parseType("a -> b -> b"), Expr: mk.Abst("x", "y")(mk.Var("y", -1))})
 }
 
 func (env *Env) Add(d parse.Definition) error {
@@ -195,7 +209,7 @@ func (env *Env) Add(d parse.Definition) error {
 		return env.addFunc(d.Name, &function{value})
 	}
 
-	panic("unreachable")
+	return &Error{nil, fmt.Sprintf("unsupported definition of %s: %T", d.Name, d.Value)}
 }
 
 func (env *Env) SourceInfo(name string, index int) *parseinfo.Source {
@@ -212,6 +226,24 @@ func (env *Env) TypeInfo(name string, index int) types.Type {
 	return env.funcs[name][index].TypeInfo()
 }
 
+// TypeName returns the definition of a type name, nil if there's no such type.
+func (env *Env) TypeName(name string) types.Name {
+	env.lazyInit()
+	return env.names[name]
+}
+
+// Unions returns all the union types defined in the environment.
+func (env *Env) Unions() map[string]*types.Union {
+	env.lazyInit()
+	unions := make(map[string]*types.Union)
+	for name, def := range env.names {
+		if union, ok := def.(*types.Union); ok {
+			unions[name] = union
+		}
+	}
+	return unions
+}
+
 func (env *Env) addRecord(name string, record *types.Record) error {
 	if env.names[name] != nil {
 		return &Error{
@@ -352,6 +384,11 @@ func (env *Env) addAlias(name string, alias *types.Alias) error {
 }
 
 func (env *Env) addFunc(name string, imp funcImpl) error {
+	if impl, ok := imp.(*internal); ok {
+		if op, ok := impl.Expr.(*crux.Operator); ok {
+			env.operatorArities[op.Code] = arity(impl.Type)
+		}
+	}
 	env.funcs[name] = append(env.funcs[name], imp)
 	return nil
 }
@@ -0,0 +1,44 @@
+package compile
+
+import (
+	"testing"
+
+	"github.com/faiface/funky/parse"
+)
+
+// testPrelude defines the types the built-in functions refer to
+const testPrelude = `
+union Bool = true | false
+union List a = empty | a :: List a
+alias String = List Char
+`
+
+// testEnv adds the definitions in src to a new environment
+func testEnv(t *testing.T, src string) *Env {
+	t.Helper()
+	tokens, err := parse.Tokenize("test.fn", src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	definitions, err := parse.Definitions(tokens)
+	if err != nil {
+		t.Fatal(err)
+	}
+	env := new(Env)
+	for _, def := range definitions {
+		if err := env.Add(def); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return env
+}
+
+// checkedEnv is testEnv which also validates and type checks the definitions
+func checkedEnv(t *testing.T, src string) *Env {
+	t.Helper()
+	env := testEnv(t, src)
+	for _, err := range append(env.Validate(), env.TypeInfer()...) {
+		t.Fatal(err)
+	}
+	return env
+}
@@ -0,0 +1,45 @@
+package compile
+
+import "github.com/faiface/funky/expr"
+
+type Resolution struct {
+	Var   *expr.Var
+	Index int // -1 for local variables
+}
+
+func (env *Env) Explain(name string, index int) []Resolution {
+	env.lazyInit()
+
+	if len(env.funcs[name]) <= index {
+		return nil
+	}
+	function, ok := env.funcs[name][index].(*function)
+	if !ok {
+		return nil
+	}
+
+	var resolutions []Resolution
+	env.explain(nil, function.Expr, &resolutions)
+	return resolutions
+}
+
+func (env *Env) explain(locals []string, e expr.Expr, resolutions *[]Resolution) {
+	switch e := e.(type) {
+	case *expr.Var:
+		if index, ok := env.resolve(locals, e); ok {
+			*resolutions = append(*resolutions, Resolution{e, int(index)})
+		}
+	case *expr.Abst:
+		env.explain(append(locals, e.Bound.Name), e.Body, resolutions)
+	case *expr.Appl:
+		env.explain(locals, e.Left, resolutions)
+		env.explain(locals, e.Right, resolutions)
+	case *expr.Strict:
+		env.explain(locals, e.Expr, resolutions)
+	case *expr.Switch:
+		env.explain(locals, e.Expr, resolutions)
+		for _, cas := range e.Cases {
+			env.explain(locals, cas.Body, resolutions)
+		}
+	}
+}
@@ -0,0 +1,49 @@
+package compile
+
+import (
+	"testing"
+
+	"github.com/faiface/funky/parse"
+)
+
+// fuzzSeeds are the seed corpus of FuzzCompile, including inputs that used to crash
+var fuzzSeeds = []string{
+	`func main : String = "Hello, world!"`,
+	`func main : Int = (\x x + 1) 2`,
+	`record Point = x : Int, y : Int
+func main : Int = x (Point 1 2)`,
+	`union Maybe a = none | some a
+func main : Int = switch some 1 case none 0 case some \x x`,
+	`func main : List Int = [1, 2, 3]`,
+	`func main : Int = _?`,
+	`func A : A =[,]`,
+	`func A : a = switch 0 case A case A 0`,
+}
+
+func FuzzCompile(f *testing.F) {
+	for _, seed := range fuzzSeeds {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, src string) {
+		tokens, err := parse.Tokenize("fuzz.fn", testPrelude+src)
+		if err != nil {
+			return
+		}
+		definitions, err := parse.Definitions(tokens)
+		if err != nil {
+			return
+		}
+		env := new(Env)
+		for _, def := range definitions {
+			if err := env.Add(def); err != nil {
+				return
+			}
+		}
+		if len(env.Validate()) > 0 || len(env.TypeInfer()) > 0 {
+			return
+		}
+		if len(env.funcs["main"]) == 1 {
+			env.Compile("main")
+		}
+	})
+}
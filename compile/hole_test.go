@@ -0,0 +1,60 @@
+package compile
+
+import (
+	"strings"
+	"testing"
+)
+
+const holeDefinitions = testPrelude + `
+
+func not : Bool -> Bool =
+    \b
+    switch b
+    case true  false
+    case false true
+
+func self : a -> a = \x x
+`
+
+func TestHoleReportsLocalsAndFits(t *testing.T) {
+	env := testEnv(t, holeDefinitions+`
+func f : Bool -> Char -> Bool = \x \c _?
+`)
+	if errs := env.Validate(); len(errs) > 0 {
+		t.Fatal(errs)
+	}
+	errs := env.TypeInfer()
+	if len(errs) != 1 {
+		t.Fatalf("expected 1 error, got %v", errs)
+	}
+	expected := `test.fn:15:39: hole _? has type: Bool
+  local variables:
+    c : Char
+    x : Bool
+  fitting functions:
+    false : Bool
+    true : Bool`
+	if msg := errs[0].Error(); msg != expected {
+		t.Errorf("expected:\n%s\ngot:\n%s", expected, msg)
+	}
+}
+
+func TestHoleFitsFunctionsByUnification(t *testing.T) {
+	env := testEnv(t, holeDefinitions+`
+func g : Bool -> Bool = ?fn
+`)
+	env.Validate()
+	errs := env.TypeInfer()
+	if len(errs) != 1 {
+		t.Fatalf("expected 1 error, got %v", errs)
+	}
+	msg := errs[0].Error()
+	// not fits exactly, self needs its type specialized, so it comes after
+	if !strings.Contains(msg, "hole ?fn has type: Bool -> Bool") ||
+		!strings.Contains(msg, "    g : Bool -> Bool\n    not : Bool -> Bool\n    self : a -> a") {
+		t.Errorf("unexpected hole report:\n%s", msg)
+	}
+	if strings.Contains(msg, "local variables") {
+		t.Errorf("no local variables expected:\n%s", msg)
+	}
+}
@@ -0,0 +1,69 @@
+package compile
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestTypeErrors(t *testing.T) {
+	tests := []struct {
+		src      string
+		expected []string
+	}{
+		{
+			// reported at the function being applied
+			src: `func f : Bool -> Bool = \b b
+func g : Bool = f (empty)`,
+			expected: []string{
+				"test.fn:6:17: cannot apply; in case function has type:\nBool -> Bool\n  and argument has type: List a",
+				"cannot unify Bool -> Bool with List a -> Bool: Bool is not List",
+			},
+		},
+		{
+			src: `func f : Char = (strict true : Char)`,
+			expected: []string{
+				"test.fn:5:18: does not match required type: Char\nadmissible types are:\n  Bool",
+				"cannot unify Char with Bool: Char is not Bool",
+			},
+		},
+		{
+			src: `func z : Int = 0
+func z : Char = 'a'
+func let : a -> (a -> b) -> b = \x \f f x
+func f : Bool = let z \x true`,
+			expected: []string{
+				"ambiguous, multiple admissible types:",
+				"hint: x is a local variable, annotate the function binding it or its argument",
+			},
+		},
+		{
+			src: `func z : Int = 0
+func z : Char = 'a'
+func const : a -> b -> a = \x \_ x
+func f : Bool = const true z`,
+			expected: []string{
+				"test.fn:8:28: ambiguous, multiple admissible types:",
+				"hint: disambiguate with a type annotation, one of:",
+				"\n  (z : Int)",
+				"\n  (z : Char)",
+			},
+		},
+	}
+
+	for _, test := range tests {
+		env := testEnv(t, testPrelude+test.src)
+		if errs := env.Validate(); len(errs) > 0 {
+			t.Fatal(errs)
+		}
+		errs := env.TypeInfer()
+		if len(errs) != 1 {
+			t.Errorf("%s: expected 1 error, got %v", test.src, errs)
+			continue
+		}
+		for _, expected := range test.expected {
+			if !strings.Contains(errs[0].Error(), expected) {
+				t.Errorf("%s: error doesn't contain %q:\n%v", test.src, expected, errs[0])
+			}
+		}
+	}
+}
@@ -0,0 +1,499 @@
+package compile
+
+import (
+	"github.com/faiface/crux"
+	"github.com/faiface/crux/runtime"
+)
+
+// Options turn off individual optimization passes.
+type Options struct {
+	NoInline    bool // don't inline small functions
+	NoBeta      bool // don't reduce immediately applied abstractions
+	NoFold      bool // don't evaluate operators on literals
+	NoKnownCase bool // don't reduce switches and field accesses on known constructors
+
+	NoStrictness bool // don't evaluate arguments strictly where strictness analysis allows
+}
+
+const (
+	optimizeRounds = 4  // maximum number of times all the passes run on a function
+	maxInlineSize  = 16 // maximum number of nodes of an inlined function
+)
+
+// optimize operates on translated expressions before lifting, so beta reduction is free to
+// leave abstractions with free variables around.
+func (env *Env) optimize(e crux.Expr) crux.Expr {
+	for round := 0; round < optimizeRounds; round++ {
+		before := env.stats
+		if !env.Options.NoInline {
+			e = rewrite(e, env.inline)
+		}
+		if !env.Options.NoBeta {
+			e = compress(rewrite(e, env.beta))
+		}
+		if !env.Options.NoKnownCase {
+			e = compress(rewrite(e, env.knownCase))
+		}
+		if !env.Options.NoFold {
+			e = rewrite(e, env.fold)
+		}
+		if env.stats == before {
+			break
+		}
+	}
+	return e
+}
+
+// rewrite applies f to all the subexpressions bottom-up
+func rewrite(e crux.Expr, f func(crux.Expr) crux.Expr) crux.Expr {
+	switch e := e.(type) {
+	case *crux.Char, *crux.Int, *crux.Float, *crux.Operator, *crux.Make, *crux.Field, *crux.Var:
+		return f(e)
+
+	case *crux.Abst:
+		return f(&crux.Abst{Bound: e.Bound, Body: rewrite(e.Body, f)})
+
+	case *crux.Appl:
+		rewrittenRands := make([]crux.Expr, len(e.Rands))
+		for i := range rewrittenRands {
+			rewrittenRands[i] = rewrite(e.Rands[i], f)
+		}
+		return f(&crux.Appl{Rator: rewrite(e.Rator, f), Rands: rewrittenRands})
+
+	case *crux.Strict:
+		return f(&crux.Strict{Expr: rewrite(e.Expr, f)})
+
+	case *crux.Switch:
+		rewrittenCases := make([]crux.Expr, len(e.Cases))
+		for i := range rewrittenCases {
+			rewrittenCases[i] = rewrite(e.Cases[i], f)
+		}
+		return f(&crux.Switch{Expr: rewrite(e.Expr, f), Cases: rewrittenCases})
+
+	default:
+		panic("unreachable")
+	}
+}
+
+// translated returns the overload before lifting, which is what gets inlined
+func (env *Env) translated(name string, index int) crux.Expr {
+	switch impl := env.funcs[name][index].(type) {
+	case *internal:
+		return impl.Expr
+	case *function:
+		return compress(env.translate(nil, impl.Expr))
+	default:
+		panic("unreachable")
+	}
+}
+
+func (env *Env) inline(e crux.Expr) crux.Expr {
+	v, ok := e.(*crux.Var)
+	if !ok || v.Index < 0 {
+		return e
+	}
+	if _, ok := env.funcs[v.Name][v.Index].(*internal); ok && v.Name == "par" {
+		// native programs recognize par by its name, inlined it wouldn't spark anything
+		return e
+	}
+	body := env.translated(v.Name, int(v.Index))
+	switch body.(type) {
+	case *crux.Abst, *crux.Char, *crux.Int, *crux.Float, *crux.Operator, *crux.Make, *crux.Field, *crux.Var:
+	default:
+		// inlining anything else would lose sharing of its evaluated value
+		return e
+	}
+	if size(body) > maxInlineSize || refersTo(body, v) {
+		return e
+	}
+	env.stats.Inlined++
+	return body
+}
+
+func (env *Env) beta(e crux.Expr) crux.Expr {
+	appl, ok := e.(*crux.Appl)
+	if !ok {
+		return e
+	}
+	abst, ok := appl.Rator.(*crux.Abst)
+	if !ok {
+		return e
+	}
+
+	n := len(abst.Bound)
+	if len(appl.Rands) < n {
+		n = len(appl.Rands)
+	}
+
+	var (
+		body        = abst.Body
+		keptBound   []string
+		keptRands   []crux.Expr
+		substituted = 0
+	)
+	for i := 0; i < n; i++ {
+		name, rand := abst.Bound[i], appl.Rands[i]
+		if contains(abst.Bound[i+1:], name) {
+			// shadowed by a later parameter, so unused
+			substituted++
+			continue
+		}
+		binders := append(append(keptBound[:len(keptBound):len(keptBound)], abst.Bound[i+1:]...), binderNames(body)...)
+		if !substitutable(body, name, rand) || capturesAny(binders, rand) {
+			keptBound = append(keptBound, name)
+			keptRands = append(keptRands, rand)
+			continue
+		}
+		body = substitute(body, name, rand)
+		substituted++
+	}
+	if substituted == 0 {
+		return e
+	}
+	env.stats.BetaReduced += substituted
+
+	result := body
+	if rest := abst.Bound[n:]; len(keptBound)+len(rest) > 0 {
+		result = &crux.Abst{Bound: append(keptBound, rest...), Body: body}
+	}
+	if len(keptRands) > 0 {
+		result = &crux.Appl{Rator: result, Rands: keptRands}
+	}
+	if len(appl.Rands) > n {
+		result = &crux.Appl{Rator: result, Rands: appl.Rands[n:]}
+	}
+	return result
+}
+
+func (env *Env) knownCase(e crux.Expr) crux.Expr {
+	// a field of a record being constructed
+	if appl, ok := e.(*crux.Appl); ok && len(appl.Rands) == 1 {
+		field, ok := appl.Rator.(*crux.Field)
+		if !ok {
+			return e
+		}
+		record, ok := appl.Rands[0].(*crux.Appl)
+		if !ok {
+			return e
+		}
+		if _, ok := record.Rator.(*crux.Make); !ok || int(field.Index) >= len(record.Rands) {
+			return e
+		}
+		env.stats.KnownCases++
+		return record.Rands[field.Index]
+	}
+
+	sw, ok := e.(*crux.Switch)
+	if !ok {
+		return e
+	}
+	var (
+		constructor *crux.Make
+		fields      []crux.Expr
+	)
+	switch x := sw.Expr.(type) {
+	case *crux.Make:
+		constructor = x
+	case *crux.Appl:
+		constructor, _ = x.Rator.(*crux.Make)
+		fields = x.Rands
+	}
+	if constructor == nil || int(constructor.Index) >= len(sw.Cases) {
+		return e
+	}
+	env.stats.KnownCases++
+	if len(fields) == 0 {
+		return sw.Cases[constructor.Index]
+	}
+	return &crux.Appl{Rator: sw.Cases[constructor.Index], Rands: fields}
+}
+
+func (env *Env) fold(e crux.Expr) crux.Expr {
+	appl, ok := e.(*crux.Appl)
+	if !ok {
+		return e
+	}
+	op, ok := appl.Rator.(*crux.Operator)
+	if !ok {
+		return e
+	}
+	folded := foldOperator(op.Code, appl.Rands)
+	if folded == nil {
+		return e
+	}
+	env.stats.Folded++
+	return folded
+}
+
+// foldOperator only handles operators whose result doesn't depend on details of the runtime,
+// returns nil if the application can't be folded
+func foldOperator(code int32, rands []crux.Expr) crux.Expr {
+	switch len(rands) {
+	case 1:
+		switch x := rands[0].(type) {
+		case *crux.Char:
+			switch code {
+			case runtime.OpCharInt:
+				return mkInt(func(z *crux.Int) { z.Value.SetInt64(int64(x.Value)) })
+			}
+		case *crux.Int:
+			switch code {
+			case runtime.OpIntNeg:
+				return mkInt(func(z *crux.Int) { z.Value.Neg(&x.Value) })
+			case runtime.OpIntAbs:
+				return mkInt(func(z *crux.Int) { z.Value.Abs(&x.Value) })
+			case runtime.OpIntIsZero:
+				return mkBool(x.Value.Sign() == 0)
+			}
+		case *crux.Float:
+			switch code {
+			case runtime.OpFloatNeg:
+				return &crux.Float{Value: -x.Value}
+			}
+		}
+
+	case 2:
+		switch x := rands[0].(type) {
+		case *crux.Char:
+			y, ok := rands[1].(*crux.Char)
+			if !ok {
+				return nil
+			}
+			switch code {
+			case runtime.OpCharEq:
+				return mkBool(x.Value == y.Value)
+			case runtime.OpCharNeq:
+				return mkBool(x.Value != y.Value)
+			case runtime.OpCharLess:
+				return mkBool(x.Value < y.Value)
+			case runtime.OpCharLessEq:
+				return mkBool(x.Value <= y.Value)
+			case runtime.OpCharMore:
+				return mkBool(x.Value > y.Value)
+			case runtime.OpCharMoreEq:
+				return mkBool(x.Value >= y.Value)
+			}
+		case *crux.Int:
+			y, ok := rands[1].(*crux.Int)
+			if !ok {
+				return nil
+			}
+			switch code {
+			case runtime.OpIntAdd:
+				return mkInt(func(z *crux.Int) { z.Value.Add(&x.Value, &y.Value) })
+			case runtime.OpIntSub:
+				return mkInt(func(z *crux.Int) { z.Value.Sub(&x.Value, &y.Value) })
+			case runtime.OpIntMul:
+				return mkInt(func(z *crux.Int) { z.Value.Mul(&x.Value, &y.Value) })
+			case runtime.OpIntEq:
+				return mkBool(x.Value.Cmp(&y.Value) == 0)
+			case runtime.OpIntNeq:
+				return mkBool(x.Value.Cmp(&y.Value) != 0)
+			case runtime.OpIntLess:
+				return mkBool(x.Value.Cmp(&y.Value) < 0)
+			case runtime.OpIntLessEq:
+				return mkBool(x.Value.Cmp(&y.Value) <= 0)
+			case runtime.OpIntMore:
+				return mkBool(x.Value.Cmp(&y.Value) > 0)
+			case runtime.OpIntMoreEq:
+				return mkBool(x.Value.Cmp(&y.Value) >= 0)
+			}
+		case *crux.Float:
+			y, ok := rands[1].(*crux.Float)
+			if !ok {
+				return nil
+			}
+			switch code {
+			case runtime.OpFloatAdd:
+				return &crux.Float{Value: x.Value + y.Value}
+			case runtime.OpFloatSub:
+				return &crux.Float{Value: x.Value - y.Value}
+			case runtime.OpFloatMul:
+				return &crux.Float{Value: x.Value * y.Value}
+			case runtime.OpFloatDiv:
+				return &crux.Float{Value: x.Value / y.Value}
+			case runtime.OpFloatEq:
+				return mkBool(x.Value == y.Value)
+			case runtime.OpFloatNeq:
+				return mkBool(x.Value != y.Value)
+			case runtime.OpFloatLess:
+				return mkBool(x.Value < y.Value)
+			case runtime.OpFloatLessEq:
+				return mkBool(x.Value <= y.Value)
+			case runtime.OpFloatMore:
+				return mkBool(x.Value > y.Value)
+			case runtime.OpFloatMoreEq:
+				return mkBool(x.Value >= y.Value)
+			}
+		}
+	}
+	return nil
+}
+
+func mkInt(set func(*crux.Int)) crux.Expr {
+	var z crux.Int
+	set(&z)
+	return &z
+}
+
+// true and false are the first and the second alternative of Bool
+func mkBool(b bool) crux.Expr {
+	if b {
+		return &crux.Make{Index: 0}
+	}
+	return &crux.Make{Index: 1}
+}
+
+func size(e crux.Expr) int {
+	switch e := e.(type) {
+	case *crux.Char, *crux.Int, *crux.Float, *crux.Operator, *crux.Make, *crux.Field, *crux.Var:
+		return 1
+	case *crux.Abst:
+		return 1 + size(e.Body)
+	case *crux.Appl:
+		n := 1 + size(e.Rator)
+		for _, rand := range e.Rands {
+			n += size(rand)
+		}
+		return n
+	case *crux.Strict:
+		return 1 + size(e.Expr)
+	case *crux.Switch:
+		n := 1 + size(e.Expr)
+		for _, cas := range e.Cases {
+			n += size(cas)
+		}
+		return n
+	default:
+		panic("unreachable")
+	}
+}
+
+func refersTo(e crux.Expr, global *crux.Var) bool {
+	found := false
+	mapVars(e, func(v *crux.Var) crux.Expr {
+		if v.Index >= 0 && v.Name == global.Name && v.Index == global.Index {
+			found = true
+		}
+		return v
+	})
+	return found
+}
+
+// substitutable reports whether substituting rand for the local doesn't duplicate work
+func substitutable(body crux.Expr, local string, rand crux.Expr) bool {
+	switch rand.(type) {
+	case *crux.Char, *crux.Int, *crux.Float, *crux.Operator, *crux.Make, *crux.Field, *crux.Var:
+		return true
+	case *crux.Strict:
+		// substituting would delay the evaluation
+		return false
+	}
+	count, underAbst := occurrences(body, local, false)
+	return count == 0 || (count == 1 && !underAbst)
+}
+
+func occurrences(e crux.Expr, local string, underAbst bool) (count int, anyUnderAbst bool) {
+	switch e := e.(type) {
+	case *crux.Char, *crux.Int, *crux.Float, *crux.Operator, *crux.Make, *crux.Field:
+		return 0, false
+	case *crux.Var:
+		if e.Index < 0 && e.Name == local {
+			return 1, underAbst
+		}
+		return 0, false
+	case *crux.Abst:
+		if contains(e.Bound, local) {
+			return 0, false
+		}
+		return occurrences(e.Body, local, true)
+	case *crux.Appl:
+		count, anyUnderAbst = occurrences(e.Rator, local, underAbst)
+		for _, rand := range e.Rands {
+			c, u := occurrences(rand, local, underAbst)
+			count, anyUnderAbst = count+c, anyUnderAbst || u
+		}
+		return count, anyUnderAbst
+	case *crux.Strict:
+		return occurrences(e.Expr, local, underAbst)
+	case *crux.Switch:
+		count, anyUnderAbst = occurrences(e.Expr, local, underAbst)
+		// only one case gets evaluated, abstractions in cases may be alternatives' fields as well
+		// as resulting functions, so they're counted as abstractions
+		maxCount := 0
+		for _, cas := range e.Cases {
+			c, u := occurrences(cas, local, underAbst)
+			if c > maxCount {
+				maxCount = c
+			}
+			anyUnderAbst = anyUnderAbst || u
+		}
+		return count + maxCount, anyUnderAbst
+	default:
+		panic("unreachable")
+	}
+}
+
+func substitute(e crux.Expr, local string, rand crux.Expr) crux.Expr {
+	switch e := e.(type) {
+	case *crux.Char, *crux.Int, *crux.Float, *crux.Operator, *crux.Make, *crux.Field:
+		return e
+	case *crux.Var:
+		if e.Index < 0 && e.Name == local {
+			return rand
+		}
+		return e
+	case *crux.Abst:
+		if contains(e.Bound, local) {
+			return e
+		}
+		return &crux.Abst{Bound: e.Bound, Body: substitute(e.Body, local, rand)}
+	case *crux.Appl:
+		substitutedRands := make([]crux.Expr, len(e.Rands))
+		for i := range substitutedRands {
+			substitutedRands[i] = substitute(e.Rands[i], local, rand)
+		}
+		return &crux.Appl{Rator: substitute(e.Rator, local, rand), Rands: substitutedRands}
+	case *crux.Strict:
+		return &crux.Strict{Expr: substitute(e.Expr, local, rand)}
+	case *crux.Switch:
+		substitutedCases := make([]crux.Expr, len(e.Cases))
+		for i := range substitutedCases {
+			substitutedCases[i] = substitute(e.Cases[i], local, rand)
+		}
+		return &crux.Switch{Expr: substitute(e.Expr, local, rand), Cases: substitutedCases}
+	default:
+		panic("unreachable")
+	}
+}
+
+func binderNames(e crux.Expr) []string {
+	var names []string
+	rewrite(e, func(e crux.Expr) crux.Expr {
+		if abst, ok := e.(*crux.Abst); ok {
+			names = append(names, abst.Bound...)
+		}
+		return e
+	})
+	return names
+}
+
+// capturesAny conservatively reports whether any of the binders would capture a free variable
+// of the substituted expression
+func capturesAny(binders []string, rand crux.Expr) bool {
+	for _, binder := range binders {
+		if isFree(binder, rand) {
+			return true
+		}
+	}
+	return false
+}
+
+func contains(names []string, name string) bool {
+	for _, n := range names {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,178 @@
+package compile
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/faiface/crux"
+	"github.com/faiface/crux/mk"
+	"github.com/faiface/crux/runtime"
+)
+
+func TestInline(t *testing.T) {
+	env := checkedEnv(t, testPrelude+`
+func double : Int -> Int = \x x + x
+func loop : Int -> Int = \x loop x
+func number : Int = 4 + 5
+`)
+	tests := []struct {
+		name    string
+		inlined bool
+	}{
+		{"double", true},
+		{"loop", false},   // recursive
+		{"number", false}, // an application, inlining would lose sharing of its value
+	}
+	for _, test := range tests {
+		env.stats = Stats{}
+		v := mk.Var(test.name, 0)
+		result := env.inline(v)
+		if inlined := result != v; inlined != test.inlined {
+			t.Errorf("%s: inlined %v, want %v", test.name, inlined, test.inlined)
+		}
+		if test.inlined && env.stats.Inlined != 1 {
+			t.Errorf("%s: inlined stat %d, want 1", test.name, env.stats.Inlined)
+		}
+	}
+}
+
+func TestBeta(t *testing.T) {
+	expensive := mk.Appl(mk.Var("f", -1), mk.Var("y", -1))
+	tests := []struct {
+		name string
+		e    crux.Expr
+		want crux.Expr
+	}{
+		{
+			"literal substituted",
+			mk.Appl(mk.Abst("x")(mk.Appl(mk.Var("g", -1), mk.Var("x", -1), mk.Var("x", -1))), &crux.Int{}),
+			mk.Appl(mk.Var("g", -1), &crux.Int{}, &crux.Int{}),
+		},
+		{
+			"used once substituted",
+			mk.Appl(mk.Abst("x")(mk.Appl(mk.Var("g", -1), mk.Var("x", -1))), expensive),
+			mk.Appl(mk.Var("g", -1), expensive),
+		},
+		{
+			"used twice kept",
+			mk.Appl(mk.Abst("x")(mk.Appl(mk.Var("g", -1), mk.Var("x", -1), mk.Var("x", -1))), expensive),
+			nil,
+		},
+		{
+			"under abstraction kept",
+			mk.Appl(mk.Abst("x")(mk.Abst("z")(mk.Var("x", -1))), expensive),
+			nil,
+		},
+		{
+			// the case may be a field of the alternative or a resulting function, so it may be
+			// applied many times and substituting would evaluate the argument each time
+			"under abstraction in switch case kept",
+			mk.Appl(mk.Abst("x")(mk.Switch(mk.Var("s", -1),
+				mk.Abst("a")(mk.Var("x", -1)),
+				mk.Var("x", -1),
+			)), expensive),
+			nil,
+		},
+		{
+			"capture kept",
+			mk.Appl(mk.Abst("x")(mk.Abst("y")(mk.Appl(mk.Var("x", -1), mk.Var("y", -1)))), mk.Var("y", -1)),
+			nil,
+		},
+	}
+	for _, test := range tests {
+		env := new(Env)
+		got := env.beta(test.e)
+		want := test.want
+		if want == nil {
+			want = test.e
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: got %#v, want %#v", test.name, got, want)
+		}
+		if reduced := env.stats.BetaReduced > 0; reduced != (test.want != nil) {
+			t.Errorf("%s: beta reduced %d", test.name, env.stats.BetaReduced)
+		}
+	}
+}
+
+func TestFold(t *testing.T) {
+	int64Expr := func(i int64) *crux.Int {
+		x := new(crux.Int)
+		x.Value.SetInt64(i)
+		return x
+	}
+	tests := []struct {
+		name string
+		e    crux.Expr
+		want crux.Expr
+	}{
+		{"int add", mk.Appl(mk.Op(runtime.OpIntAdd), int64Expr(2), int64Expr(3)), int64Expr(5)},
+		{"int neg", mk.Appl(mk.Op(runtime.OpIntNeg), int64Expr(2)), int64Expr(-2)},
+		{"char eq", mk.Appl(mk.Op(runtime.OpCharEq), &crux.Char{Value: 'a'}, &crux.Char{Value: 'a'}), mk.Make(0)},
+		{"float neg", mk.Appl(mk.Op(runtime.OpFloatNeg), &crux.Float{Value: 1.5}), &crux.Float{Value: -1.5}},
+		{"variable", mk.Appl(mk.Op(runtime.OpIntAdd), int64Expr(2), mk.Var("x", -1)), nil},
+	}
+	for _, test := range tests {
+		env := new(Env)
+		got := env.fold(test.e)
+		want := test.want
+		if want == nil {
+			want = test.e
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: got %#v, want %#v", test.name, got, want)
+		}
+		if folded := env.stats.Folded > 0; folded != (test.want != nil) {
+			t.Errorf("%s: folded %d", test.name, env.stats.Folded)
+		}
+	}
+}
+
+func TestKnownCase(t *testing.T) {
+	a, b := mk.Var("a", -1), mk.Var("b", -1)
+	tests := []struct {
+		name string
+		e    crux.Expr
+		want crux.Expr
+	}{
+		{"switch on constructor", mk.Switch(mk.Make(1), a, b), b},
+		{
+			"switch on constructor with fields",
+			mk.Switch(mk.Appl(mk.Make(1), a, b), mk.Var("c0", -1), mk.Var("c1", -1)),
+			mk.Appl(mk.Var("c1", -1), a, b),
+		},
+		{"field of record", mk.Appl(mk.Field(1), mk.Appl(mk.Make(0), a, b)), b},
+		{"switch on variable", mk.Switch(mk.Var("x", -1), a, b), nil},
+		{"field out of constructed fields", mk.Appl(mk.Field(1), mk.Appl(mk.Make(0), a)), nil},
+	}
+	for _, test := range tests {
+		env := new(Env)
+		got := env.knownCase(test.e)
+		want := test.want
+		if want == nil {
+			want = test.e
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: got %#v, want %#v", test.name, got, want)
+		}
+		if known := env.stats.KnownCases > 0; known != (test.want != nil) {
+			t.Errorf("%s: known cases %d", test.name, env.stats.KnownCases)
+		}
+	}
+}
+
+// TestKnownCaseFires checks that the passes together reduce a switch on a constant, which needs
+// the constructor and the function switching on it inlined first
+func TestKnownCaseFires(t *testing.T) {
+	env := checkedEnv(t, testPrelude+`
+func if : Bool -> a -> a -> a = \b \t \e switch b case true t case false e
+func main : Int = if true 1 2
+`)
+	_, _, _, _, _, errs := env.Compile("main")
+	for _, err := range errs {
+		t.Fatal(err)
+	}
+	if env.Stats().KnownCases == 0 {
+		t.Errorf("no known cases in %+v", env.Stats())
+	}
+}
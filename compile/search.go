@@ -0,0 +1,149 @@
+package compile
+
+import (
+	"sort"
+
+	"github.com/faiface/funky/types"
+	"github.com/faiface/funky/types/typecheck"
+)
+
+// arguments of functions with more arguments than this are not tried in all orders
+const maxPermutedArgs = 5
+
+type SearchResult struct {
+	Name  string
+	Index int
+	Type  types.Type
+	Score int // lower is better
+}
+
+func (env *Env) Search(query types.Type) ([]SearchResult, error) {
+	env.lazyInit()
+
+	err := env.validateType(freeVars(query), query)
+	if err != nil {
+		return nil, err
+	}
+
+	var results []SearchResult
+	for name, impls := range env.funcs {
+		for i, imp := range impls {
+			score, ok := env.searchScore(query, imp.TypeInfo())
+			if !ok {
+				continue
+			}
+			results = append(results, SearchResult{name, i, imp.TypeInfo(), score})
+		}
+	}
+
+	sort.Slice(results, func(i, j int) bool {
+		if results[i].Score != results[j].Score {
+			return results[i].Score < results[j].Score
+		}
+		if results[i].Name != results[j].Name {
+			return results[i].Name < results[j].Name
+		}
+		return results[i].Index < results[j].Index
+	})
+
+	return results, nil
+}
+
+func (env *Env) searchScore(query, t types.Type) (score int, ok bool) {
+	queryArgs, queryResult := splitFunc(query)
+	args, result := splitFunc(t)
+	if len(args) != len(queryArgs) {
+		return 0, false
+	}
+
+	perms := [][]int{identity(len(args))}
+	if len(args) <= maxPermutedArgs {
+		perms = permutations(len(args))
+	}
+
+	for _, perm := range perms {
+		permuted := make([]types.Type, len(args))
+		reordered := 0
+		for i := range perm {
+			permuted[i] = args[perm[i]]
+			if perm[i] != i {
+				reordered = 1
+			}
+		}
+		s, matches := env.matchScore(queryArgs, queryResult, permuted, result)
+		if !matches {
+			continue
+		}
+		// reordering is only a small penalty compared to a worse match
+		s = 2*s + reordered
+		if !ok || s < score {
+			score, ok = s, true
+		}
+	}
+
+	return score, ok
+}
+
+// matchScore ranks how well a function type matches the query:
+// 0 - same types, 1 - function is more general, 2 - function is more specific, 3 - types only unify
+func (env *Env) matchScore(queryArgs []types.Type, queryResult types.Type, args []types.Type, result types.Type) (int, bool) {
+	query, t := joinFunc(queryArgs, queryResult), joinFunc(args, result)
+	general := typecheck.IsSpec(env.names, t, query)
+	specific := typecheck.IsSpec(env.names, query, t)
+	switch {
+	case general && specific:
+		return 0, true
+	case general:
+		return 1, true
+	case specific:
+		return 2, true
+	case typecheck.CheckIfUnify(env.names, query, t):
+		return 3, true
+	}
+	return 0, false
+}
+
+func splitFunc(t types.Type) (args []types.Type, result types.Type) {
+	for {
+		f, ok := t.(*types.Func)
+		if !ok {
+			return args, t
+		}
+		args = append(args, f.From)
+		t = f.To
+	}
+}
+
+func joinFunc(args []types.Type, result types.Type) types.Type {
+	t := result
+	for i := len(args) - 1; i >= 0; i-- {
+		t = &types.Func{From: args[i], To: t}
+	}
+	return t
+}
+
+func identity(n int) []int {
+	perm := make([]int, n)
+	for i := range perm {
+		perm[i] = i
+	}
+	return perm
+}
+
+func permutations(n int) [][]int {
+	if n == 0 {
+		return [][]int{{}}
+	}
+	var perms [][]int
+	for _, perm := range permutations(n - 1) {
+		// insert n-1 at every position
+		for i := 0; i <= len(perm); i++ {
+			newPerm := make([]int, 0, n)
+			newPerm = append(newPerm, perm[:i]...)
+			newPerm = append(newPerm, n-1)
+			newPerm = append(newPerm, perm[i:]...)
+			perms = append(perms, newPerm)
+		}
+	}
+	return perms
+}
@@ -0,0 +1,88 @@
+package compile
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/faiface/funky/parse"
+)
+
+const searchSrc = testPrelude + `
+union Foo = foo
+union Bar = bar
+union Box a = box a
+
+func exact           : Foo -> Bar -> Box Foo = \f \b box f
+func swapped         : Bar -> Foo -> Box Foo = \b \f box f
+func general         : a -> Bar -> Box a     = \x \b box x
+func general-swapped : Bar -> a -> Box a     = \b \x box x
+func other           : Foo -> Bar -> Box Bar = \f \b box b
+
+func unbox     : Box a -> a     = \b switch b case box \x x
+func unbox-foo : Box Foo -> Foo = \b switch b case box \x x
+func any       : Box a -> b     = \b any b
+
+func five : Foo -> Bar -> Box Foo -> Box Bar -> List Foo -> Foo =
+    \a \b \c \d \e a
+func six  : Foo -> Bar -> Box Foo -> Box Bar -> List Foo -> List Bar -> Foo =
+    \a \b \c \d \e \f a
+`
+
+func TestSearch(t *testing.T) {
+	env := testEnv(t, searchSrc)
+	tests := []struct {
+		query    string
+		expected []string // name:score, in the order of the results
+	}{
+		// exact, reordered, generalized and reordered generalized matches
+		{"Foo -> Bar -> Box Foo", []string{"exact:0", "swapped:1", "general:2", "general-swapped:3"}},
+		{"Bar -> Foo -> Box Foo", []string{"swapped:0", "exact:1", "general-swapped:2", "general:3"}},
+		// more general functions score better than more specific ones, the same scores go by name
+		{"Box Foo -> Foo", []string{"unbox-foo:0", "any:2", "unbox:2"}},
+		{"Box a -> a", []string{"unbox:0", "any:2", "unbox-foo:4"}},
+		// arguments of up to five functions get permuted
+		{"Bar -> Foo -> Box Foo -> Box Bar -> List Foo -> Foo", []string{"five:1"}},
+		{"Foo -> Bar -> Box Foo -> Box Bar -> List Foo -> List Bar -> Foo", []string{"six:0"}},
+		{"Bar -> Foo -> Box Foo -> Box Bar -> List Foo -> List Bar -> Foo", nil},
+		// no results
+		{"Foo -> Foo -> Foo -> Box Bar", nil},
+	}
+	for _, test := range tests {
+		tokens, err := parse.Tokenize("query", test.query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		query, err := parse.Type(tokens)
+		if err != nil {
+			t.Fatal(err)
+		}
+		results, err := env.Search(query)
+		if err != nil {
+			t.Errorf("%s: %v", test.query, err)
+			continue
+		}
+		var got []string
+		for _, r := range results {
+			got = append(got, fmt.Sprintf("%s:%d", r.Name, r.Score))
+		}
+		if strings.Join(got, " ") != strings.Join(test.expected, " ") {
+			t.Errorf("%s:\ngot  %v\nwant %v", test.query, got, test.expected)
+		}
+	}
+}
+
+func TestSearchInvalidQuery(t *testing.T) {
+	env := testEnv(t, searchSrc)
+	tokens, err := parse.Tokenize("query", "Baz -> Foo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	query, err := parse.Type(tokens)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := env.Search(query); err == nil {
+		t.Error("searched for a type that doesn't exist")
+	}
+}
@@ -0,0 +1,84 @@
+package compile
+
+import (
+	"fmt"
+
+	"github.com/faiface/crux"
+	"github.com/faiface/crux/runtime"
+	"github.com/faiface/funky/parse/parseinfo"
+)
+
+type Frame struct {
+	Name       string
+	Overload   int
+	SourceInfo *parseinfo.Source
+}
+
+func (f Frame) String() string {
+	return fmt.Sprintf("%s/%d at %v", f.Name, f.Overload, f.SourceInfo)
+}
+
+// SourceTable maps globals and all the code nodes they consist of to the definitions
+// they were compiled from.
+type SourceTable struct {
+	Globals map[int32]Frame
+	Codes   map[*runtime.Code]Frame
+}
+
+func NewSourceTable(
+	globalIndices map[string][]int32,
+	codeIndices map[string][]int32,
+	codes []runtime.Code,
+	sourceInfos map[string][]*parseinfo.Source,
+) *SourceTable {
+	table := &SourceTable{
+		Globals: make(map[int32]Frame),
+		Codes:   make(map[*runtime.Code]Frame),
+	}
+	for name := range globalIndices {
+		for i, globalIndex := range globalIndices[name] {
+			if globalIndex < 0 {
+				continue // pruned
+			}
+			frame := Frame{Name: name, Overload: i}
+			if i < len(sourceInfos[name]) {
+				frame.SourceInfo = sourceInfos[name][i]
+			}
+			table.Globals[globalIndex] = frame
+			table.addCodes(&codes[codeIndices[name][i]], frame)
+		}
+	}
+	return table
+}
+
+func (table *SourceTable) addCodes(code *runtime.Code, frame Frame) {
+	table.Codes[code] = frame
+	for i := range code.Table {
+		table.addCodes(&code.Table[i], frame)
+	}
+}
+
+// Origin returns the definition whose code the value is an unevaluated part of. It's not
+// a stack trace, crux doesn't expose its reduction stack, so evaluated values have no origin.
+// The code of inlined functions belongs to the definitions they were inlined into. Native
+// programs record the whole stack of the definitions instead, see runtime.Error.
+func (table *SourceTable) Origin(value runtime.Value) (frame Frame, ok bool) {
+	thunk, ok := value.(*runtime.Thunk)
+	if !ok || thunk.Code == nil {
+		return Frame{}, false
+	}
+	frame, ok = table.Codes[thunk.Code]
+	return frame, ok
+}
+
+// locatePanic makes the message of a panic start with the location of the call to panic,
+// the message gets prepended by the location as a string of characters. That's the location
+// in the function that panics, for example in the standard library, not in its caller.
+func locatePanic(si *parseinfo.Source, op crux.Expr) crux.Expr {
+	var msg crux.Expr = &crux.Var{Name: "msg", Index: -1}
+	prefix := []rune(fmt.Sprintf("%v: ", si))
+	for i := len(prefix) - 1; i >= 0; i-- {
+		msg = &crux.Appl{Rator: &crux.Make{Index: 1}, Rands: []crux.Expr{&crux.Char{Value: prefix[i]}, msg}}
+	}
+	return &crux.Abst{Bound: []string{"msg"}, Body: &crux.Appl{Rator: op, Rands: []crux.Expr{msg}}}
+}
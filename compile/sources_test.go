@@ -0,0 +1,28 @@
+package compile
+
+import (
+	"testing"
+
+	"github.com/faiface/crux/runtime"
+)
+
+func TestOrigin(t *testing.T) {
+	env := checkedEnv(t, testPrelude+`
+func double : Int -> Int = \x x + x
+func main : Int = double 4
+`)
+	globalIndices, globalValues, _, _, sources, errs := env.Compile("main")
+	for _, err := range errs {
+		t.Fatal(err)
+	}
+	frame, ok := sources.Origin(globalValues[globalIndices["main"][0]])
+	if !ok {
+		t.Fatal("no origin of main")
+	}
+	if frame.Name != "main" || frame.Overload != 0 || frame.SourceInfo.Line != 7 {
+		t.Errorf("got origin %v, want main/0 at test.fn:7", frame)
+	}
+	if frame, ok := sources.Origin(&runtime.Char{Value: 'x'}); ok {
+		t.Errorf("got origin %v of an evaluated value", frame)
+	}
+}
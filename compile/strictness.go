@@ -0,0 +1,279 @@
+package compile
+
+import (
+	"github.com/faiface/crux"
+	"github.com/faiface/crux/runtime"
+	"github.com/faiface/funky/expr"
+	"github.com/faiface/funky/types"
+)
+
+type global struct {
+	Name  string
+	Index int
+}
+
+// strictness tells for each global function which of its parameters it always forces
+type strictness struct {
+	env    *Env
+	params map[global][]bool
+}
+
+// strictify wraps arguments in calls of functions that force them anyway in crux.Strict,
+// so that they don't get allocated as thunks. The analysis runs on the typed expressions,
+// because there the number of fields of each alternative in a switch is known.
+func (env *Env) strictify(globals map[global]crux.Expr) {
+	s := env.analyzeStrictness()
+
+	for g, e := range globals {
+		globals[g] = rewrite(e, func(e crux.Expr) crux.Expr {
+			appl, ok := e.(*crux.Appl)
+			if !ok {
+				return e
+			}
+			strict := s.strictRands(appl)
+			if strict == nil {
+				return e
+			}
+			rands := make([]crux.Expr, len(appl.Rands))
+			copy(rands, appl.Rands)
+			for i := range strict {
+				switch rands[i].(type) {
+				case *crux.Char, *crux.Int, *crux.Float, *crux.Operator, *crux.Make, *crux.Field, *crux.Abst, *crux.Strict:
+					continue // already evaluated
+				}
+				if strict[i] {
+					rands[i] = &crux.Strict{Expr: rands[i]}
+					env.stats.Strictified++
+				}
+			}
+			return &crux.Appl{Rator: appl.Rator, Rands: rands}
+		})
+	}
+}
+
+// analyzeStrictness finds the strict parameters of all the functions
+func (env *Env) analyzeStrictness() *strictness {
+	s := &strictness{
+		env:    env,
+		params: make(map[global][]bool),
+	}
+
+	// start by assuming all parameters are strict and weaken until nothing changes,
+	// this way recursive functions get the best results. All functions are analyzed,
+	// because the unreachable ones may have been inlined into the reachable ones.
+	for name := range env.funcs {
+		for index, impl := range env.funcs[name] {
+			if f, ok := impl.(*function); ok {
+				bound, _ := params(f.Expr)
+				g := global{name, index}
+				s.params[g] = make([]bool, len(bound))
+				for i := range s.params[g] {
+					s.params[g][i] = true
+				}
+			}
+		}
+	}
+	for changed := true; changed; {
+		changed = false
+		for g := range s.params {
+			bound, body := params(env.funcs[g.Name][g.Index].(*function).Expr)
+			forced := s.forced(bound, body)
+			for i := range bound {
+				// a parameter shadowed by a later one is never used
+				if s.params[g][i] && (!forced[bound[i]] || contains(bound[i+1:], bound[i])) {
+					s.params[g][i] = false
+					changed = true
+				}
+			}
+		}
+	}
+	return s
+}
+
+// strictRands returns which arguments of a saturated call to a global function are forced
+func (s *strictness) strictRands(appl *crux.Appl) []bool {
+	v, ok := appl.Rator.(*crux.Var)
+	if !ok || v.Index < 0 {
+		return nil
+	}
+	params := s.params[global{v.Name, int(v.Index)}]
+	if len(params) == 0 || len(appl.Rands) < len(params) {
+		return nil
+	}
+	return params
+}
+
+func params(e expr.Expr) (bound []string, body expr.Expr) {
+	for {
+		abst, ok := e.(*expr.Abst)
+		if !ok {
+			return bound, e
+		}
+		bound = append(bound, abst.Bound.Name)
+		e = abst.Body
+	}
+}
+
+// forced returns local variables that are always forced when the expression gets evaluated
+func (s *strictness) forced(locals []string, e expr.Expr) map[string]bool {
+	switch e := e.(type) {
+	case *expr.Char, *expr.Int, *expr.Float, *expr.Hole, *expr.Abst:
+		return nil
+
+	case *expr.Var:
+		if contains(locals, e.Name) {
+			return map[string]bool{e.Name: true}
+		}
+		return nil
+
+	case *expr.Appl:
+		var (
+			head = expr.Expr(e)
+			args []expr.Expr
+		)
+		for {
+			appl, ok := head.(*expr.Appl)
+			if !ok {
+				break
+			}
+			args = append([]expr.Expr{appl.Right}, args...)
+			head = appl.Left
+		}
+
+		switch head := head.(type) {
+		case *expr.Var:
+			index, ok := s.env.resolve(locals, head)
+			if !ok {
+				return nil
+			}
+			if index < 0 {
+				return map[string]bool{head.Name: true}
+			}
+			forced := make(map[string]bool)
+			switch impl := s.env.funcs[head.Name][index].(type) {
+			case *internal:
+				switch x := impl.Expr.(type) {
+				case *crux.Operator:
+					if x.Code == runtime.OpError || x.Code == runtime.OpDump {
+						break
+					}
+					if arity := arity(impl.Type); len(args) >= arity {
+						for _, arg := range args[:arity] {
+							union(forced, s.forced(locals, arg))
+						}
+					}
+				case *crux.Field:
+					union(forced, s.forced(locals, args[0]))
+				}
+			case *function:
+				strict := s.params[global{head.Name, int(index)}]
+				if len(args) >= len(strict) {
+					for i := range strict {
+						if strict[i] {
+							union(forced, s.forced(locals, args[i]))
+						}
+					}
+				}
+			}
+			return forced
+
+		case *expr.Abst:
+			// the abstraction gets applied right away, the rest of the arguments go to its body
+			var body expr.Expr = head.Body
+			for _, arg := range args[1:] {
+				body = &expr.Appl{Left: body, Right: arg}
+			}
+			forcedBody := s.forced(append(locals[:len(locals):len(locals)], head.Bound.Name), body)
+			forced := make(map[string]bool)
+			for local := range forcedBody {
+				if local == head.Bound.Name {
+					union(forced, s.forced(locals, args[0]))
+				} else {
+					forced[local] = true
+				}
+			}
+			return forced
+
+		default:
+			return s.forced(locals, head)
+		}
+
+	case *expr.Strict:
+		return s.forced(locals, e.Expr)
+
+	case *expr.Switch:
+		forced := s.forced(locals, e.Expr)
+		if forced == nil {
+			forced = make(map[string]bool)
+		}
+		alts := s.env.unionOf(e.Expr.TypeInfo())
+		if alts == nil || len(alts.Alts) != len(e.Cases) {
+			return forced
+		}
+		// only variables forced in all the cases
+		var inAllCases map[string]bool
+		for i, cas := range e.Cases {
+			var (
+				body       = cas.Body
+				caseLocals = locals[:len(locals):len(locals)]
+				fields     []string
+			)
+			for range alts.Alts[i].Fields {
+				abst, ok := body.(*expr.Abst)
+				if !ok {
+					break
+				}
+				fields = append(fields, abst.Bound.Name)
+				caseLocals = append(caseLocals, abst.Bound.Name)
+				body = abst.Body
+			}
+			inCase := make(map[string]bool)
+			for local := range s.forced(caseLocals, body) {
+				if !contains(fields, local) && (i == 0 || inAllCases[local]) {
+					inCase[local] = true
+				}
+			}
+			inAllCases = inCase
+		}
+		union(forced, inAllCases)
+		return forced
+
+	default:
+		panic("unreachable")
+	}
+}
+
+func arity(t types.Type) int {
+	n := 0
+	for {
+		f, ok := t.(*types.Func)
+		if !ok {
+			return n
+		}
+		t = f.To
+		n++
+	}
+}
+
+func (env *Env) unionOf(t types.Type) *types.Union {
+	for {
+		appl, ok := t.(*types.Appl)
+		if !ok {
+			return nil
+		}
+		switch name := env.names[appl.Name].(type) {
+		case *types.Union:
+			return name
+		case *types.Alias:
+			t = name.Type
+		default:
+			return nil
+		}
+	}
+}
+
+func union(dst, src map[string]bool) {
+	for local := range src {
+		dst[local] = true
+	}
+}
@@ -0,0 +1,46 @@
+package compile
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestStrictness(t *testing.T) {
+	env := checkedEnv(t, testPrelude+`
+func if : Bool -> a -> a -> a = \b \t \e switch b case true t case false e
+func add : Int -> Int -> Int = \x \y x + y
+func const : a -> b -> a = \x \y x
+func sum : Int -> List Int -> Int =
+    \acc \list
+    switch list
+    case empty acc
+    case (::) \x \xs sum (acc + x) xs
+func loop : Int -> Int -> Int = \x \y loop x y
+func pick : Bool -> Int -> Int -> Int = \b \x \y switch b case true (x + y) case false x
+func lazy-pick : Bool -> Int -> Int -> Int = \b \x \y if b x y
+func cons : Int -> List Int -> List Int = \x \xs x :: xs
+func shadow : Int -> Int -> Int = \x \x x
+func panicking : Int -> Int = \x panic "no"
+`)
+	s := env.analyzeStrictness()
+	tests := []struct {
+		name   string
+		strict []bool
+	}{
+		{"if", []bool{true, false, false}},
+		{"add", []bool{true, true}},
+		{"const", []bool{true, false}},
+		{"sum", []bool{true, true}},  // recursive, found by the fixpoint
+		{"loop", []bool{true, true}}, // never returns, so it may as well force everything
+		{"pick", []bool{true, true, false}},
+		{"lazy-pick", []bool{true, false, false}}, // each forced only in one case of if
+		{"cons", []bool{false, false}},
+		{"shadow", []bool{false, true}},
+		{"panicking", []bool{false}},
+	}
+	for _, test := range tests {
+		if got := s.params[global{test.name, 0}]; !reflect.DeepEqual(got, test.strict) {
+			t.Errorf("%s: got %v, want %v", test.name, got, test.strict)
+		}
+	}
+}
@@ -2,6 +2,8 @@ package compile
 
 import (
 	"fmt"
+	"sort"
+	"strings"
 
 	"github.com/faiface/funky/parse/parseinfo"
 	"github.com/faiface/funky/types"
@@ -31,6 +33,12 @@ func (env *Env) Validate() []error {
 		}
 	}
 
+	// cyclic aliases would make the type checker expand them forever
+	cycleErrs := env.validateAliasCycles()
+	if len(cycleErrs) > 0 {
+		return append(errs, cycleErrs...)
+	}
+
 	for name, impls := range env.funcs {
 	implsLoop:
 		for i, imp := range impls {
@@ -179,6 +187,64 @@ func (env *Env) validateAlias(alias *types.Alias) error {
 	return nil
 }
 
+func (env *Env) validateAliasCycles() []error {
+	var aliasNames []string
+	for name, definition := range env.names {
+		if _, ok := definition.(*types.Alias); ok {
+			aliasNames = append(aliasNames, name)
+		}
+	}
+	sort.Strings(aliasNames)
+
+	var (
+		errs  []error
+		done  = make(map[string]bool)
+		stack []string
+		visit func(name string)
+	)
+
+	visit = func(name string) {
+		for i := range stack {
+			if stack[i] == name {
+				cycle := append(stack[i:len(stack):len(stack)], name)
+				errs = append(errs, &Error{
+					env.names[name].SourceInfo(),
+					fmt.Sprintf("alias cycle: %s", strings.Join(cycle, " -> ")),
+				})
+				return
+			}
+		}
+		if done[name] {
+			return
+		}
+		stack = append(stack, name)
+		for _, used := range aliasesIn(env.names, env.names[name].(*types.Alias).Type) {
+			visit(used)
+		}
+		stack = stack[:len(stack)-1]
+		done[name] = true
+	}
+
+	for _, name := range aliasNames {
+		visit(name)
+	}
+
+	return errs
+}
+
+func aliasesIn(names map[string]types.Name, t types.Type) []string {
+	var aliases []string
+	t.Map(func(t types.Type) types.Type {
+		if appl, ok := t.(*types.Appl); ok {
+			if _, ok := names[appl.Name].(*types.Alias); ok {
+				aliases = append(aliases, appl.Name)
+			}
+		}
+		return t
+	})
+	return aliases
+}
+
 func validateArgs(si *parseinfo.Source, args []string) error {
 	for i := range args {
 		for j := range args[:i] {
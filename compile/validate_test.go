@@ -0,0 +1,48 @@
+package compile
+
+import (
+	"testing"
+)
+
+func TestValidateAliasCycles(t *testing.T) {
+	tests := []struct {
+		name     string
+		src      string
+		expected []string
+	}{
+		{
+			name:     "direct",
+			src:      `alias A = A`,
+			expected: []string{"test.fn:1:7: alias cycle: A -> A"},
+		},
+		{
+			name: "indirect",
+			src: `alias A = List B
+alias B = Int -> A`,
+			expected: []string{"test.fn:1:7: alias cycle: A -> B -> A"},
+		},
+		{
+			name: "acyclic chain",
+			src: `alias A = List B
+alias B = Int -> C
+alias C = Char
+alias D = A -> C`,
+		},
+	}
+	for _, test := range tests {
+		env := testEnv(t, test.src)
+		var got []string
+		for _, err := range env.validateAliasCycles() {
+			got = append(got, err.Error())
+		}
+		if len(got) != len(test.expected) {
+			t.Errorf("%s: got %q, want %q", test.name, got, test.expected)
+			continue
+		}
+		for i := range got {
+			if got[i] != test.expected[i] {
+				t.Errorf("%s: got %q, want %q", test.name, got[i], test.expected[i])
+			}
+		}
+	}
+}
@@ -14,6 +14,9 @@ func dumpCodes(w io.Writer, globalIndices map[string][]int32, code *runtime.Code
 	})
 	for name := range globalIndices {
 		for i := range globalIndices[name] {
+			if globalIndices[name][i] < 0 {
+				continue // pruned
+			}
 			indicesToGlobals[globalIndices[name][i]] = struct {
 				Name  string
 				Index int32
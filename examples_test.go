@@ -0,0 +1,190 @@
+package funky
+
+import (
+	"bytes"
+	"flag"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/faiface/funky/interpreters/funkycmd/driver"
+	"github.com/faiface/funky/runtime"
+)
+
+var update = flag.Bool("update", false, "write the outputs of the transcripts into the .golden files")
+
+// transcripts returns the names of the examples with transcripts in examples/testdata
+func transcripts(t testing.TB) []string {
+	t.Helper()
+	paths, err := filepath.Glob(filepath.Join("examples", "testdata", "*.in"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, path := range paths {
+		names = append(names, strings.TrimSuffix(filepath.Base(path), ".in"))
+	}
+	return names
+}
+
+// TestExamples runs the transcripts of the examples the way funkygolden does and compares
+// the outputs with the .golden files.
+func TestExamples(t *testing.T) {
+	for _, name := range transcripts(t) {
+		t.Run(name, func(t *testing.T) {
+			input, err := ioutil.ReadFile(filepath.Join("examples", "testdata", name+".in"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			env := exampleEnv(t, name)
+			exprs, errs := env.Exprs("main")
+			for _, err := range errs {
+				t.Fatal(err)
+			}
+			output, err := runTranscript(exprs, env.OperatorArity, input, 100000000)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			goldenPath := filepath.Join("examples", "testdata", name+".golden")
+			if *update {
+				if err := ioutil.WriteFile(goldenPath, output, 0666); err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			expected, err := ioutil.ReadFile(goldenPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(output, expected) {
+				t.Errorf("output differs from %s\n%s", goldenPath, firstDifference(string(expected), string(output)))
+			}
+		})
+	}
+}
+
+func TestRunTranscriptBudget(t *testing.T) {
+	env := exampleEnv(t, "simple-chess")
+	exprs, errs := env.Exprs("main")
+	for _, err := range errs {
+		t.Fatal(err)
+	}
+	input, err := ioutil.ReadFile(filepath.Join("examples", "testdata", "simple-chess.in"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected, err := ioutil.ReadFile(filepath.Join("examples", "testdata", "simple-chess.golden"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := runTranscript(exprs, env.OperatorArity, input, 1000); err == nil {
+		t.Fatal("finished within 1000 reductions")
+	} else if _, ok := err.(*runtime.LimitError); !ok {
+		t.Fatalf("got %v, want the reduction limit", err)
+	}
+	// the next transcript isn't affected by the exceeded one
+	output, err := runTranscript(exprs, env.OperatorArity, input, 100000000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(output, expected) {
+		t.Errorf("output differs after an exceeded budget\n%s", firstDifference(string(expected), string(output)))
+	}
+}
+
+// BenchmarkExamples runs the transcripts of the examples compiled with and without
+// the strictness analysis.
+func BenchmarkExamples(b *testing.B) {
+	for _, name := range transcripts(b) {
+		input, err := ioutil.ReadFile(filepath.Join("examples", "testdata", name+".in"))
+		if err != nil {
+			b.Fatal(err)
+		}
+		for _, noStrictness := range []bool{false, true} {
+			benchName := name
+			if noStrictness {
+				benchName += "/nostrictness"
+			}
+			b.Run(benchName, func(b *testing.B) {
+				env := exampleEnv(b, name)
+				env.Options.NoStrictness = noStrictness
+				prog, errs := compileProgram(env, "main")
+				for _, err := range errs {
+					b.Fatal(err)
+				}
+				b.ResetTimer()
+				for i := 0; i < b.N; i++ {
+					// every program starts with fresh copies of the globals
+					program := runtime.NewProgram(prog.globalValues).Global(prog.globalIndices["main"][0])
+					if err := driver.Run(program, bytes.NewReader(input), ioutil.Discard); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		}
+	}
+}
+
+// perftSrc counts the sequences of moves in the chess example, sequentially and in parallel
+const perftSrc = `
+func perft : Int -> Side -> Board -> Int =
+    \depth \turn \board
+    if (zero? depth) 1;
+    sum; map (perft-after (dec depth) turn board); all-moves turn board
+
+func par-perft : Int -> Side -> Board -> Int =
+    \depth \turn \board
+    sum; par-map (perft-after (dec depth) turn board); all-moves turn board
+
+func perft-after : Int -> Side -> Board -> Pair Position Position -> Int =
+    \depth \turn \board \p
+    let-pair p \from \to
+    perft depth (opposite turn) (move from to board)
+
+func perft-1     : Int = perft 1 white initial-board
+func par-perft-1 : Int = par-perft 1 white initial-board
+func perft-2     : Int = perft 2 white initial-board
+func par-perft-2 : Int = par-perft 2 white initial-board
+`
+
+// perftGlobals returns functions getting the perfts from a new native program
+func perftGlobals(t testing.TB) func(name string) *runtime.Value {
+	t.Helper()
+	env := checkDefinitions(t, append(exampleDefinitions(t, "simple-chess"), parseDefinitions(t, "perft.fn", perftSrc)...))
+	exprs, errs := env.Exprs("perft-1", "par-perft-1", "perft-2", "par-perft-2")
+	for _, err := range errs {
+		t.Fatal(err)
+	}
+	return func(name string) *runtime.Value {
+		program, globalIndices := runtime.NewNativeProgram(exprs, env.OperatorArity)
+		return program.Global(globalIndices[name][0])
+	}
+}
+
+func TestParPerft(t *testing.T) {
+	global := perftGlobals(t)
+	for _, name := range []string{"perft-1", "par-perft-1"} {
+		if n, err := global(name).TryInt(); err != nil || n.Int64() != 20 {
+			t.Errorf("%s: got %v, %v, want 20", name, n, err)
+		}
+	}
+}
+
+// BenchmarkParPerft searches the moves of the chess example with par-map in parallel and with
+// map sequentially, run it with -cpu 1,2,4 to see the speedup.
+func BenchmarkParPerft(b *testing.B) {
+	global := perftGlobals(b)
+	for _, name := range []string{"perft-2", "par-perft-2"} {
+		b.Run(name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				// every program starts with fresh copies of the globals
+				if _, err := global(name).TryInt(); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,34 @@
+package funky
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/faiface/funky/compile"
+)
+
+func explainResolutions(w io.Writer, env *compile.Env, name string) error {
+	if env.TypeInfo(name, 0) == nil {
+		return fmt.Errorf("no function %s to explain", name)
+	}
+	for i := 0; env.TypeInfo(name, i) != nil; i++ {
+		fmt.Fprintf(w, "%s/%d : %v\n", name, i, env.TypeInfo(name, i))
+		fmt.Fprintf(w, "  %v\n", env.SourceInfo(name, i))
+		for _, r := range env.Explain(name, i) {
+			if r.Index < 0 {
+				fmt.Fprintf(w, "    %v: %s is local\n", r.Var.SourceInfo(), r.Var.Name)
+				continue
+			}
+			fmt.Fprintf(w,
+				"    %v: %s resolves to %s/%d : %v\n",
+				r.Var.SourceInfo(),
+				r.Var.Name,
+				r.Var.Name,
+				r.Index,
+				env.TypeInfo(r.Var.Name, r.Index),
+			)
+			fmt.Fprintf(w, "      %v\n", env.SourceInfo(r.Var.Name, r.Index))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,40 @@
+package funky
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestExplainResolutions(t *testing.T) {
+	env := testEnv(t, `func f : Int -> Int = \x x + 1`)
+
+	var out bytes.Buffer
+	if err := explainResolutions(&out, env, "f"); err != nil {
+		t.Fatal(err)
+	}
+	for _, expected := range []string{
+		"f/0 : Int -> Int",
+		"test.fn:1:26: x is local",
+		"test.fn:1:28: + resolves to +/",
+	} {
+		if !strings.Contains(out.String(), expected) {
+			t.Errorf("output doesn't contain %q:\n%s", expected, out.String())
+		}
+	}
+	if !strings.Contains(out.String(), ": Int -> Int -> Int") {
+		t.Errorf("+ should resolve to the Int overload:\n%s", out.String())
+	}
+}
+
+func TestExplainUnknownName(t *testing.T) {
+	env := testEnv(t, ``)
+	var out bytes.Buffer
+	err := explainResolutions(&out, env, "no-such-function")
+	if err == nil || err.Error() != "no function no-such-function to explain" {
+		t.Errorf("expected an error, got %v", err)
+	}
+	if out.Len() > 0 {
+		t.Errorf("expected no output, got:\n%s", out.String())
+	}
+}
@@ -41,6 +41,12 @@ type (
 		Name string
 	}
 
+	Hole struct {
+		TI   types.Type
+		SI   *parseinfo.Source
+		Name string // _? or ?name
+	}
+
 	Abst struct {
 		TI    types.Type
 		SI    *parseinfo.Source
@@ -76,6 +82,7 @@ func (c *Char) TypeInfo() types.Type   { return &types.Appl{Name: "Char"} }
 func (i *Int) TypeInfo() types.Type    { return &types.Appl{Name: "Int"} }
 func (f *Float) TypeInfo() types.Type  { return &types.Appl{Name: "Float"} }
 func (v *Var) TypeInfo() types.Type    { return v.TI }
+func (h *Hole) TypeInfo() types.Type   { return h.TI }
 func (a *Abst) TypeInfo() types.Type   { return a.TI }
 func (a *Appl) TypeInfo() types.Type   { return a.TI }
 func (s *Strict) TypeInfo() types.Type { return s.TI }
@@ -85,6 +92,7 @@ func (c *Char) WithTypeInfo(types.Type) Expr     { return c }
 func (i *Int) WithTypeInfo(types.Type) Expr      { return i }
 func (f *Float) WithTypeInfo(types.Type) Expr    { return f }
 func (v *Var) WithTypeInfo(t types.Type) Expr    { return &Var{t, v.SI, v.Name} }
+func (h *Hole) WithTypeInfo(t types.Type) Expr   { return &Hole{t, h.SI, h.Name} }
 func (a *Abst) WithTypeInfo(t types.Type) Expr   { return &Abst{t, a.SI, a.Bound, a.Body} }
 func (a *Appl) WithTypeInfo(t types.Type) Expr   { return &Appl{t, a.Left, a.Right} }
 func (s *Strict) WithTypeInfo(t types.Type) Expr { return &Strict{t, s.SI, s.Expr} }
@@ -102,6 +110,7 @@ func (c *Char) SourceInfo() *parseinfo.Source   { return c.SI }
 func (i *Int) SourceInfo() *parseinfo.Source    { return i.SI }
 func (f *Float) SourceInfo() *parseinfo.Source  { return f.SI }
 func (v *Var) SourceInfo() *parseinfo.Source    { return v.SI }
+func (h *Hole) SourceInfo() *parseinfo.Source   { return h.SI }
 func (a *Abst) SourceInfo() *parseinfo.Source   { return a.SI }
 func (a *Appl) SourceInfo() *parseinfo.Source   { return a.Left.SourceInfo() }
 func (s *Strict) SourceInfo() *parseinfo.Source { return s.SI }
@@ -111,6 +120,7 @@ func (c *Char) Map(f func(Expr) Expr) Expr   { return f(c) }
 func (i *Int) Map(f func(Expr) Expr) Expr    { return f(i) }
 func (f *Float) Map(fn func(Expr) Expr) Expr { return fn(f) }
 func (v *Var) Map(f func(Expr) Expr) Expr    { return f(v) }
+func (h *Hole) Map(f func(Expr) Expr) Expr   { return f(h) }
 func (a *Abst) Map(f func(Expr) Expr) Expr {
 	return f(&Abst{a.TI, a.SI, a.Bound.Map(f).(*Var), a.Body.Map(f)})
 }
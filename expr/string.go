@@ -9,6 +9,7 @@ func (c *Char) leftString() string   { return c.String() }
 func (i *Int) leftString() string    { return i.String() }
 func (f *Float) leftString() string  { return f.String() }
 func (v *Var) leftString() string    { return v.Name }
+func (h *Hole) leftString() string   { return h.Name }
 func (a *Abst) leftString() string   { return "(" + a.String() + ")" }
 func (a *Appl) leftString() string   { return a.String() }
 func (s *Strict) leftString() string { return s.String() }
@@ -18,6 +19,7 @@ func (c *Char) rightString() string   { return c.String() }
 func (i *Int) rightString() string    { return i.String() }
 func (f *Float) rightString() string  { return f.String() }
 func (v *Var) rightString() string    { return v.Name }
+func (h *Hole) rightString() string   { return h.Name }
 func (a *Abst) rightString() string   { return "(" + a.String() + ")" }
 func (a *Appl) rightString() string   { return "(" + a.String() + ")" }
 func (s *Strict) rightString() string { return s.String() }
@@ -27,6 +29,7 @@ func (c *Char) String() string  { return strconv.QuoteRune(c.Value) }
 func (i *Int) String() string   { return i.Value.Text(10) }
 func (f *Float) String() string { return fmt.Sprint(f.Value) }
 func (v *Var) String() string   { return v.Name }
+func (h *Hole) String() string  { return h.Name }
 func (a *Abst) String() string  { return fmt.Sprintf("\\%v %v", a.Bound, a.Body) }
 func (a *Appl) String() string {
 	return fmt.Sprintf("%s %s", a.Left.leftString(), a.Right.rightString())
@@ -0,0 +1,123 @@
+package funky
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/faiface/crux"
+	"github.com/faiface/funky/compile"
+	"github.com/faiface/funky/interpreters/funkycmd/driver"
+	"github.com/faiface/funky/runtime"
+)
+
+// Golden runs the main IO program with the transcripts given after -- on the command line. Each
+// transcript is a file with the input, like game.in, and the expected output is in game.golden.
+// The program fails a transcript if its output differs, if it panics, or if it doesn't finish
+// within the reduction budget. With -update, the outputs get written into the .golden files.
+func Golden() {
+	noStdlib := flag.Bool("nostd", false, "do not automatically include files from $FUNKY")
+	update := flag.Bool("update", false, "write the outputs into the .golden files instead of comparing them")
+	budget := flag.Int("budget", 100000000, "number of reductions a transcript may take")
+	flag.Parse()
+
+	transcripts := ProgramArgs()
+	if len(transcripts) == 0 {
+		handleErrs(errors.New("no transcripts, list them after --"))
+	}
+
+	definitions := readDefinitions(*noStdlib, "cmd", sourceArgs())
+	env := new(compile.Env)
+	for _, def := range definitions {
+		handleErrs(env.Add(def))
+	}
+	handleErrs(env.Validate()...)
+	handleErrs(env.TypeInfer()...)
+	exprs, errs := env.Exprs("main")
+	handleErrs(errs...)
+	if len(exprs["main"]) != 1 {
+		handleErrs(errors.New("there must be exactly one main function"))
+	}
+
+	failed := 0
+	for _, path := range transcripts {
+		goldenPath := strings.TrimSuffix(path, ".in") + ".golden"
+
+		input, err := ioutil.ReadFile(path)
+		handleErrs(err)
+		output, err := runTranscript(exprs, env.OperatorArity, input, *budget)
+		if err != nil {
+			fmt.Printf("--- FAIL: %s: %v\n", path, err)
+			failed++
+			continue
+		}
+
+		if *update {
+			handleErrs(ioutil.WriteFile(goldenPath, output, 0666))
+			continue
+		}
+		expected, err := ioutil.ReadFile(goldenPath)
+		if err != nil {
+			fmt.Printf("--- FAIL: %s: %v\n", path, err)
+			failed++
+			continue
+		}
+		if !bytes.Equal(output, expected) {
+			fmt.Printf("--- FAIL: %s: output differs from %s\n", path, goldenPath)
+			fmt.Print(firstDifference(string(expected), string(output)))
+			failed++
+		}
+	}
+
+	if failed > 0 {
+		fmt.Printf("FAIL: %d of %d transcripts failed\n", failed, len(transcripts))
+		os.Exit(1)
+	}
+	fmt.Printf("ok: %d transcripts\n", len(transcripts))
+}
+
+// runTranscript runs the compiled main function with the input within the budget. Every
+// transcript runs in its own native program, which stops as soon as it exceeds the budget.
+func runTranscript(exprs map[string][]crux.Expr, operatorArity func(code int32) int, input []byte, budget int) (output []byte, err error) {
+	program, globalIndices := runtime.NewNativeProgram(exprs, operatorArity)
+	main := program.Global(globalIndices["main"][0]).WithLimits(&runtime.Limits{MaxReductions: budget})
+
+	defer func() {
+		if r := recover(); r != nil {
+			switch r := r.(type) {
+			case *runtime.Error:
+				err = fmt.Errorf("panic: %s", r.Msg)
+			case *runtime.LimitError:
+				err = r
+			default:
+				err = fmt.Errorf("panic: %v", r)
+			}
+		}
+	}()
+
+	var out bytes.Buffer
+	err = driver.Run(main, bytes.NewReader(input), &out)
+	return out.Bytes(), err
+}
+
+func firstDifference(expected, actual string) string {
+	expectedLines := strings.SplitAfter(expected, "\n")
+	actualLines := strings.SplitAfter(actual, "\n")
+	for i := 0; i < len(expectedLines) || i < len(actualLines); i++ {
+		var e, a string
+		if i < len(expectedLines) {
+			e = expectedLines[i]
+		}
+		if i < len(actualLines) {
+			a = actualLines[i]
+		}
+		if e != a {
+			return fmt.Sprintf("    line %d\n    expected: %q\n    actual:   %q\n", i+1, e, a)
+		}
+	}
+	return ""
+}
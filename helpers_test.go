@@ -0,0 +1,104 @@
+package funky
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/faiface/funky/compile"
+	"github.com/faiface/funky/parse"
+	"github.com/faiface/funky/runtime"
+)
+
+// testEnv type checks the source together with the standard library of funkycmd
+func testEnv(t testing.TB, src string) *compile.Env {
+	t.Helper()
+	return checkDefinitions(t, parseDefinitions(t, "test.fn", src))
+}
+
+// exampleEnv type checks the example with the name, either examples/name.fn or all the files
+// in examples/name, together with the standard library of funkycmd
+func exampleEnv(t testing.TB, name string) *compile.Env {
+	t.Helper()
+	return checkDefinitions(t, exampleDefinitions(t, name))
+}
+
+// exampleDefinitions parses the example with the name, see exampleEnv
+func exampleDefinitions(t testing.TB, name string) []parse.Definition {
+	t.Helper()
+	paths, err := filepath.Glob(filepath.Join("examples", name, "*.fn"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(paths) == 0 {
+		paths = []string{filepath.Join("examples", name+".fn")}
+	}
+	var definitions []parse.Definition
+	for _, path := range paths {
+		b, err := ioutil.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		definitions = append(definitions, parseDefinitions(t, path, string(b))...)
+	}
+	return definitions
+}
+
+// checkDefinitions type checks the definitions together with the standard library of funkycmd
+func checkDefinitions(t testing.TB, definitions []parse.Definition) *compile.Env {
+	t.Helper()
+	err := filepath.Walk("stdlib", func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			if path == "stdlib" || path == filepath.Join("stdlib", "cmd") {
+				return nil
+			}
+			return filepath.SkipDir
+		}
+		b, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		definitions = append(definitions, parseDefinitions(t, path, string(b))...)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	env := new(compile.Env)
+	for _, def := range definitions {
+		if err := env.Add(def); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, err := range append(env.Validate(), env.TypeInfer()...) {
+		t.Fatal(err)
+	}
+	return env
+}
+
+func parseDefinitions(t testing.TB, path, src string) []parse.Definition {
+	t.Helper()
+	tokens, err := parse.Tokenize(path, src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	definitions, err := parse.Definitions(tokens)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return definitions
+}
+
+// compileGlobal compiles the program with the global as the main function and returns its value
+func compileGlobal(t testing.TB, env *compile.Env, name string) *runtime.Value {
+	t.Helper()
+	prog, errs := compileProgram(env, name)
+	for _, err := range errs {
+		t.Fatal(err)
+	}
+	return runtime.NewProgram(prog.globalValues).Global(prog.globalIndices[name][0])
+}
@@ -0,0 +1,85 @@
+package driver
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"strings"
+
+	"github.com/faiface/funky/runtime"
+)
+
+// Run runs the IO or IO2 of the program until it quits or the input ends. The alternatives of
+// IO2 start with the ones of IO, so the driver doesn't need to know which one it is.
+func Run(program *runtime.Value, r io.Reader, w io.Writer) error {
+	in, out := bufio.NewReader(r), bufio.NewWriter(w)
+	defer out.Flush()
+	for {
+		switch program.Alternative() {
+		case 0: // quit
+			return nil
+		case 1: // putc
+			r := program.Field(0).Char()
+			_, err := out.WriteRune(r)
+			if err != nil {
+				return err
+			}
+			if r == '\n' {
+				out.Flush()
+			}
+			program = program.Field(1)
+		case 2: // getc
+			err := out.Flush()
+			if err != nil {
+				return err
+			}
+			r, _, err := in.ReadRune()
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			program = program.Field(0).Apply(runtime.MkChar(r))
+		case 3: // puts
+			// the string is written as it gets evaluated, so it may be long or infinite
+			for s := program.Field(0); s.Alternative() == 1; s = s.Field(1) {
+				r := s.Field(0).Char()
+				if _, err := out.WriteRune(r); err != nil {
+					return err
+				}
+				if r == '\n' {
+					out.Flush()
+				}
+			}
+			program = program.Field(1)
+		case 4: // getline
+			err := out.Flush()
+			if err != nil {
+				return err
+			}
+			line, err := in.ReadString('\n')
+			if err != nil && err != io.EOF {
+				return err
+			}
+			maybe := runtime.MkUnion(0)
+			if err == nil || line != "" {
+				maybe = runtime.MkUnion(1, runtime.MkString(strings.TrimSuffix(line, "\n")))
+			}
+			program = program.Field(0).Apply(maybe)
+		case 5: // getall
+			err := out.Flush()
+			if err != nil {
+				return err
+			}
+			b, err := ioutil.ReadAll(in)
+			if err != nil {
+				return err
+			}
+			program = program.Field(0).Apply(runtime.MkString(string(b)))
+		default:
+			return fmt.Errorf("unknown IO alternative %d", program.Alternative())
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package driver
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	cxr "github.com/faiface/crux/runtime"
+	"github.com/faiface/funky/runtime"
+	"github.com/faiface/funky/runtime/native"
+)
+
+func TestRun(t *testing.T) {
+	quit := runtime.MkUnion(0)
+	tests := []struct {
+		name    string
+		program *runtime.Value
+		want    string
+		err     string
+	}{
+		{"putc", runtime.MkUnion(1, runtime.MkChar('x'), quit), "x", ""},
+		{"puts", runtime.MkUnion(3, runtime.MkString("ab\nc"), runtime.MkUnion(1, runtime.MkChar('d'), quit)), "ab\ncd", ""},
+		{"unknown", runtime.MkUnion(1, runtime.MkChar('x'), runtime.MkUnion(6)), "x", "unknown IO alternative 6"},
+	}
+	for _, test := range tests {
+		var out bytes.Buffer
+		err := Run(test.program, strings.NewReader(""), &out)
+		if (err == nil) != (test.err == "") || (err != nil && err.Error() != test.err) {
+			t.Errorf("%s: got error %v, want %q", test.name, err, test.err)
+		}
+		if out.String() != test.want {
+			t.Errorf("%s: got %q, want %q", test.name, out.String(), test.want)
+		}
+	}
+}
+
+// cont returns the IO alternative taking a continuation, which is the Go function
+func cont(alternative int, fn func(arg *runtime.Value) *runtime.Value) *runtime.Value {
+	return runtime.MkUnion(alternative, &runtime.Value{Value: native.Func(1, func(args []cxr.Value) cxr.Value {
+		return fn(&runtime.Value{Value: args[0]}).Value
+	})})
+}
+
+// getlines prints the lines in brackets until the input ends
+func getlines() *runtime.Value {
+	return cont(4, func(line *runtime.Value) *runtime.Value {
+		if line.Alternative() == 0 {
+			return runtime.MkUnion(3, runtime.MkString("<eof>"), runtime.MkUnion(0))
+		}
+		return runtime.MkUnion(3, runtime.MkString("["+line.Field(0).String()+"]"), getlines())
+	})
+}
+
+// getall prints the rest of the input in brackets n times
+func getall(n int) *runtime.Value {
+	if n == 0 {
+		return runtime.MkUnion(0)
+	}
+	return cont(5, func(s *runtime.Value) *runtime.Value {
+		return runtime.MkUnion(3, runtime.MkString("["+s.String()+"]"), getall(n-1))
+	})
+}
+
+func TestRunInput(t *testing.T) {
+	tests := []struct {
+		name    string
+		program *runtime.Value
+		input   string
+		want    string
+	}{
+		{"getline", getlines(), "a\nb\n", "[a][b]<eof>"},
+		{"getline-no-newline", getlines(), "a\nb", "[a][b]<eof>"},
+		{"getline-empty-line", getlines(), "\n\n", "[][]<eof>"},
+		{"getline-eof", getlines(), "", "<eof>"},
+		{"getall", getall(2), "a\nb", "[a\nb][]"},
+		{"getall-eof", getall(1), "", "[]"},
+		{"getline-getall", cont(4, func(line *runtime.Value) *runtime.Value {
+			return runtime.MkUnion(3, runtime.MkString("["+line.Field(0).String()+"]"), getall(1))
+		}), "a\nb\nc", "[a][b\nc]"},
+	}
+	for _, test := range tests {
+		var out bytes.Buffer
+		if err := Run(test.program, strings.NewReader(test.input), &out); err != nil {
+			t.Errorf("%s: %v", test.name, err)
+		}
+		if out.String() != test.want {
+			t.Errorf("%s: got %q, want %q", test.name, out.String(), test.want)
+		}
+	}
+}
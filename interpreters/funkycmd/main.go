@@ -1,44 +1,22 @@
 package main
 
 import (
-	"bufio"
 	"fmt"
-	"io"
 	"os"
 
 	"github.com/faiface/funky"
-	"github.com/faiface/funky/runtime"
+	"github.com/faiface/funky/interpreters/funkycmd/driver"
+	"github.com/faiface/funky/types"
 )
 
 func main() {
-	program, cleanup := funky.Run("main")
+	program, typ, _, cleanup := funky.RunTyped("cmd", "main")
 	defer cleanup()
-	in, out := bufio.NewReader(os.Stdin), bufio.NewWriter(os.Stdout)
-	defer out.Flush()
-loop:
-	for {
-		switch program.Alternative() {
-		case 0: // quit
-			break loop
-		case 1: // putc
-			r := program.Field(0).Char()
-			_, err := out.WriteRune(r)
-			handleErr(err)
-			if r == '\n' {
-				out.Flush()
-			}
-			program = program.Field(1)
-		case 2: // getc
-			err := out.Flush()
-			handleErr(err)
-			r, _, err := in.ReadRune()
-			if err == io.EOF {
-				break loop
-			}
-			handleErr(err)
-			program = program.Field(0).Apply(runtime.MkChar(r))
-		}
+	if appl, ok := typ.(*types.Appl); !ok || (appl.Name != "IO" && appl.Name != "IO2") || len(appl.Args) > 0 {
+		handleErr(fmt.Errorf("main must be IO or IO2, is %v", typ))
 	}
+	err := driver.Run(program, os.Stdin, os.Stdout)
+	handleErr(err)
 }
 
 func handleErr(err error) {
@@ -0,0 +1,7 @@
+package main
+
+import "github.com/faiface/funky"
+
+func main() {
+	funky.Golden()
+}
@@ -0,0 +1,136 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+
+	"github.com/faiface/funky"
+	"github.com/faiface/funky/interpreters/interp"
+	"github.com/faiface/funky/runtime"
+)
+
+func main() {
+	var (
+		code   = 0
+		in     = bufio.NewReader(os.Stdin)
+		out    = bufio.NewWriter(os.Stdout)
+		errOut = bufio.NewWriter(os.Stderr)
+	)
+
+	interpreter := &interp.Interpreter{
+		Stdlib: "os",
+		Union:  "OS",
+		Handlers: map[string]interp.Handler{
+			"exit": {Fields: []string{"Int"}, Handle: func(fields []*runtime.Value) (*runtime.Value, error) {
+				code = int(fields[0].Int().Int64())
+				return nil, nil
+			}},
+			"putc": {Fields: []string{"Char", "OS"}, Handle: func(fields []*runtime.Value) (*runtime.Value, error) {
+				return fields[1], writeRune(out, fields[0].Char())
+			}},
+			"getc": {Fields: []string{"Char -> OS"}, Handle: func(fields []*runtime.Value) (*runtime.Value, error) {
+				if err := out.Flush(); err != nil {
+					return nil, err
+				}
+				r, _, err := in.ReadRune()
+				if err == io.EOF {
+					return nil, nil
+				}
+				if err != nil {
+					return nil, err
+				}
+				return fields[0].Apply(runtime.MkChar(r)), nil
+			}},
+			"eputc": {Fields: []string{"Char", "OS"}, Handle: func(fields []*runtime.Value) (*runtime.Value, error) {
+				return fields[1], writeRune(errOut, fields[0].Char())
+			}},
+			"read-file": {Fields: []string{"String", "Result String -> OS"}, Handle: func(fields []*runtime.Value) (*runtime.Value, error) {
+				b, err := ioutil.ReadFile(fields[0].String())
+				result := mkResult(err)
+				if err == nil {
+					result = mkOk(runtime.MkString(string(b)))
+				}
+				return fields[1].Apply(result), nil
+			}},
+			"write-file": {Fields: []string{"String", "String", "Result Nothing -> OS"}, Handle: func(fields []*runtime.Value) (*runtime.Value, error) {
+				err := ioutil.WriteFile(fields[0].String(), []byte(fields[1].String()), 0666)
+				return fields[2].Apply(mkResult(err)), nil
+			}},
+			"list-dir": {Fields: []string{"String", "Result (List String) -> OS"}, Handle: func(fields []*runtime.Value) (*runtime.Value, error) {
+				infos, err := ioutil.ReadDir(fields[0].String())
+				result := mkResult(err)
+				if err == nil {
+					var names []string
+					for _, info := range infos {
+						names = append(names, info.Name())
+					}
+					result = mkOk(mkStrings(names))
+				}
+				return fields[1].Apply(result), nil
+			}},
+			"args": {Fields: []string{"List String -> OS"}, Handle: func(fields []*runtime.Value) (*runtime.Value, error) {
+				return fields[0].Apply(mkStrings(funky.ProgramArgs())), nil
+			}},
+			"getenv": {Fields: []string{"String", "Maybe String -> OS"}, Handle: func(fields []*runtime.Value) (*runtime.Value, error) {
+				value, ok := os.LookupEnv(fields[0].String())
+				maybe := runtime.MkUnion(0)
+				if ok {
+					maybe = runtime.MkUnion(1, runtime.MkString(value))
+				}
+				return fields[1].Apply(maybe), nil
+			}},
+		},
+		Flush: func() error {
+			err := out.Flush()
+			if errOutErr := errOut.Flush(); err == nil {
+				err = errOutErr
+			}
+			return err
+		},
+	}
+
+	err := interpreter.Main("main")
+	handleErr(err)
+	os.Exit(code)
+}
+
+func writeRune(w *bufio.Writer, r rune) error {
+	_, err := w.WriteRune(r)
+	if err != nil {
+		return err
+	}
+	if r == '\n' {
+		return w.Flush()
+	}
+	return nil
+}
+
+// mkResult makes the error alternative of Result a if err isn't nil, ok nothing otherwise
+func mkResult(err error) *runtime.Value {
+	if err != nil {
+		return runtime.MkUnion(0, runtime.MkString(err.Error()))
+	}
+	return mkOk(runtime.MkUnion(0))
+}
+
+func mkOk(value *runtime.Value) *runtime.Value {
+	return runtime.MkUnion(1, value)
+}
+
+func mkStrings(strs []string) *runtime.Value {
+	values := make([]*runtime.Value, len(strs))
+	for i := range strs {
+		values[i] = runtime.MkString(strs[i])
+	}
+	return runtime.MkList(values...)
+}
+
+func handleErr(err error) {
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
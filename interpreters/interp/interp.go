@@ -0,0 +1,134 @@
+// Package interp runs Funky programs whose main value is a union of effects, such as IO,
+// by calling Go handlers bound to the names of the union's alternatives.
+package interp
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/faiface/funky"
+	"github.com/faiface/funky/parse"
+	"github.com/faiface/funky/runtime"
+	"github.com/faiface/funky/types"
+)
+
+type Handler struct {
+	// Fields are the types of the fields of the alternative, exactly as in the union's declaration
+	Fields []string
+
+	// Handle performs the effect and returns the program to continue with, usually by applying
+	// the continuation from the fields, or nil to stop.
+	Handle func(fields []*runtime.Value) (*runtime.Value, error)
+}
+
+type Interpreter struct {
+	// Stdlib is the directory in $FUNKY with the library of the interpreter, which declares
+	// the union
+	Stdlib   string
+	Union    string
+	Handlers map[string]Handler
+
+	// Flush, if not nil, gets called when the program ends, also when it fails, before the
+	// failure is reported and the process exits. It is for the output buffered by the handlers.
+	Flush func() error
+}
+
+// Main compiles or loads the program from the command line, checks that its main value is of the
+// interpreter's union type and that the handlers match the union, and runs it.
+func (in *Interpreter) Main(main string) (err error) {
+	program, typ, unions, cleanup := funky.RunTyped(in.Stdlib, main)
+	defer cleanup()
+	if in.Flush != nil {
+		defer func() {
+			if flushErr := in.Flush(); err == nil {
+				err = flushErr
+			}
+		}()
+	}
+
+	if appl, ok := typ.(*types.Appl); !ok || appl.Name != in.Union || len(appl.Args) > 0 {
+		return fmt.Errorf("%s must be %s, is %v", main, in.Union, typ)
+	}
+	handlers, err := in.bind(unions[in.Union])
+	if err != nil {
+		return err
+	}
+	return run(program, handlers)
+}
+
+// bind orders the handlers the same way as the alternatives of the union
+func (in *Interpreter) bind(union *types.Union) ([]Handler, error) {
+	if union == nil {
+		return nil, fmt.Errorf("no union %s", in.Union)
+	}
+	var (
+		handlers []Handler
+		errs     []string
+	)
+	for _, alt := range union.Alts {
+		handler, ok := in.Handlers[alt.Name]
+		if !ok {
+			errs = append(errs, fmt.Sprintf("no handler for %s", alt.Name))
+			continue
+		}
+		if err := checkFields(alt, handler.Fields); err != nil {
+			errs = append(errs, err.Error())
+		}
+		handlers = append(handlers, handler)
+	}
+	var names []string
+	for name := range in.Handlers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		found := false
+		for _, alt := range union.Alts {
+			found = found || alt.Name == name
+		}
+		if !found {
+			errs = append(errs, fmt.Sprintf("handler for %s, which is not an alternative of %s", name, in.Union))
+		}
+	}
+	if len(errs) > 0 {
+		return nil, fmt.Errorf("interpreter doesn't match %s:\n  %s", in.Union, strings.Join(errs, "\n  "))
+	}
+	return handlers, nil
+}
+
+func checkFields(alt types.Alternative, fields []string) error {
+	if len(fields) != len(alt.Fields) {
+		return fmt.Errorf("%s has %d fields, handler expects %d", alt.Name, len(alt.Fields), len(fields))
+	}
+	for i := range fields {
+		tokens, err := parse.Tokenize("", fields[i])
+		if err != nil {
+			return err
+		}
+		t, err := parse.Type(tokens)
+		if err != nil {
+			return err
+		}
+		if t == nil || !t.Equal(alt.Fields[i]) {
+			return fmt.Errorf("field %d of %s is %v, handler expects %s", i, alt.Name, alt.Fields[i], fields[i])
+		}
+	}
+	return nil
+}
+
+func run(program *runtime.Value, handlers []Handler) error {
+	for program != nil {
+		handler := handlers[program.Alternative()]
+		fields := make([]*runtime.Value, len(handler.Fields))
+		for i := range fields {
+			fields[i] = program.Field(i)
+		}
+		var err error
+		program, err = handler.Handle(fields)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,133 @@
+package interp
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/faiface/funky/compile"
+	"github.com/faiface/funky/parse"
+	"github.com/faiface/funky/runtime"
+)
+
+const consoleSrc = `
+union Bool = true | false
+union List a = empty | a :: List a
+alias String = List Char
+
+union Console = done | print String Console | ask (String -> Console)
+
+func main : Console =
+    ask \name
+    print ('h' :: 'i' :: ' ' :: name) done
+`
+
+func testEnv(t *testing.T, src string) *compile.Env {
+	t.Helper()
+	tokens, err := parse.Tokenize("test.fn", src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	definitions, err := parse.Definitions(tokens)
+	if err != nil {
+		t.Fatal(err)
+	}
+	env := new(compile.Env)
+	for _, def := range definitions {
+		if err := env.Add(def); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, err := range append(env.Validate(), env.TypeInfer()...) {
+		t.Fatal(err)
+	}
+	return env
+}
+
+// console returns the handlers of Console, which print into the output and answer every ask
+// with the name
+func console(output *strings.Builder, name string) map[string]Handler {
+	return map[string]Handler{
+		"done": {
+			Handle: func(fields []*runtime.Value) (*runtime.Value, error) { return nil, nil },
+		},
+		"print": {
+			Fields: []string{"String", "Console"},
+			Handle: func(fields []*runtime.Value) (*runtime.Value, error) {
+				output.WriteString(fields[0].String() + "\n")
+				return fields[1], nil
+			},
+		},
+		"ask": {
+			Fields: []string{"String -> Console"},
+			Handle: func(fields []*runtime.Value) (*runtime.Value, error) {
+				return fields[0].Apply(runtime.MkString(name)), nil
+			},
+		},
+	}
+}
+
+func TestBind(t *testing.T) {
+	union := testEnv(t, consoleSrc).Unions()["Console"]
+	tests := []struct {
+		name   string
+		change func(handlers map[string]Handler)
+		err    string
+	}{
+		{"match", func(handlers map[string]Handler) {}, ""},
+		{"unknown", func(handlers map[string]Handler) {
+			handlers["shout"] = handlers["print"]
+		}, "handler for shout, which is not an alternative of Console"},
+		{"field-count", func(handlers map[string]Handler) {
+			handlers["print"] = Handler{Fields: []string{"String"}}
+		}, "print has 2 fields, handler expects 1"},
+		{"field-type", func(handlers map[string]Handler) {
+			handlers["print"] = Handler{Fields: []string{"Int", "Console"}}
+		}, "field 0 of print is String, handler expects Int"},
+		{"field-invalid", func(handlers map[string]Handler) {
+			handlers["ask"] = Handler{Fields: []string{"String ->"}}
+		}, "missing operands in function type"},
+		{"missing", func(handlers map[string]Handler) {
+			delete(handlers, "done")
+		}, "no handler for done"},
+	}
+	for _, test := range tests {
+		in := &Interpreter{Union: "Console", Handlers: console(new(strings.Builder), "")}
+		test.change(in.Handlers)
+		handlers, err := in.bind(union)
+		if test.err == "" {
+			if err != nil || len(handlers) != len(union.Alts) {
+				t.Errorf("%s: got %d handlers, %v", test.name, len(handlers), err)
+			}
+			continue
+		}
+		if err == nil || !strings.HasPrefix(err.Error(), "interpreter doesn't match Console:\n") || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("%s: got error %v, want %q", test.name, err, test.err)
+		}
+	}
+
+	in := &Interpreter{Union: "Console", Handlers: console(new(strings.Builder), "")}
+	if _, err := in.bind(nil); err == nil || err.Error() != "no union Console" {
+		t.Errorf("got error %v, want no union Console", err)
+	}
+}
+
+func TestRun(t *testing.T) {
+	env := testEnv(t, consoleSrc)
+	globalIndices, globalValues, _, _, _, errs := env.Compile("main")
+	for _, err := range errs {
+		t.Fatal(err)
+	}
+	var output strings.Builder
+	in := &Interpreter{Union: "Console", Handlers: console(&output, "bob")}
+	handlers, err := in.bind(env.Unions()["Console"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	program := runtime.NewProgram(globalValues).Global(globalIndices["main"][0])
+	if err := run(program, handlers); err != nil {
+		t.Fatal(err)
+	}
+	if output.String() != "hi bob\n" {
+		t.Errorf("got %q, want %q", output.String(), "hi bob\n")
+	}
+}
@@ -0,0 +1,69 @@
+package funky
+
+import (
+	"testing"
+
+	"github.com/faiface/funky/runtime"
+)
+
+func TestMap(t *testing.T) {
+	env := testEnv(t, `
+func letters : Map String Int = ordered-map 0 [pair "b" 2, pair "a" 1, pair "c" 3, pair "a" 4]
+func sorted  : Map Int Int    = ordered-map 0 (map (\i pair i (i * i)) (rangex 1000))
+
+func show : List Int -> String = \xs join " " (map string xs)
+
+func map-keys    : String = join " " (keys letters)
+func map-at      : String = show (map (\k at k letters) ["a", "b", "z"])
+func map-removed : String = join " " (keys (remove "b" (remove "z" letters)))
+func map-updated : String = show (values (at "c" (* 10) (at "d" inc letters)))
+func map-length  : String = show [length letters, length sorted, length (remove 5 sorted)]
+func map-height  : String = string (_height (_tree sorted))
+func map-chars   : String = show (values (ordered-map 0 [pair 'z' 1, pair 'a' 2]))
+func map-floats  : String = show (keys (ordered-map 0 [pair 2.5 0, pair -1.0 0]) |> map int)
+
+func set-values  : String = show (values (ordered-set [3, 1, 2, 3, 1]))
+func set-ops     : String = show (values (ordered-set [1, 2, 3] & ordered-set [2, 3, 4]) ++ values (ordered-set [1] & ordered-set []))
+func set-strings : String = join " " (values ((ordered-set ["b", "a"] + ordered-set ["c", "a"]) - ordered-set ["b"]))
+func set-compare : String = join " " (map (\b if b "t" "f") [ordered-set [1] <= ordered-set [1, 2], ordered-set [1, 2] == ordered-set [2, 1]])
+
+func hash-at      : String = show (map (\k at k (hash-map 0 [pair "one" 1, pair "two" 2])) ["one", "two", "three"])
+func hash-floats  : String = show (map (\k at k (remove 1.75 (hash-map 0 [pair 1.5 1, pair 1.75 2, pair nan 3]))) [1.5, 1.75])
+func hash-length  : String = show [length (hash-map 0 (map (\i pair i i) (rangex 100 ++ rangex 50))), length (hash-map 0 [pair 'a' 1, pair 'a' 2])]
+func hash-chars   : String = show [at 'a' (hash-map 0 [pair 'a' 1, pair 'a' 2])]
+`)
+	tests := []struct {
+		name, want string
+	}{
+		{"map-keys", "a b c"},
+		{"map-at", "4 2 0"},
+		{"map-removed", "a c"},
+		{"map-updated", "4 2 30 1"},
+		{"map-length", "3 1000 999"},
+		{"map-height", "10"},
+		{"map-chars", "2 1"},
+		{"map-floats", "-1 2"},
+		{"set-values", "1 2 3"},
+		{"set-ops", "2 3"},
+		{"set-strings", "a c"},
+		{"set-compare", "t t"},
+		{"hash-at", "1 2 0"},
+		{"hash-floats", "1 0"},
+		{"hash-length", "100 1"},
+		{"hash-chars", "2"},
+	}
+	for _, test := range tests {
+		prog, errs := compileProgram(env, test.name)
+		for _, err := range errs {
+			t.Fatal(err)
+		}
+		got, err := runtime.NewProgram(prog.globalValues).Global(prog.globalIndices[test.name][0]).TryString()
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("%s: got %q, want %q", test.name, got, test.want)
+		}
+	}
+}
@@ -34,6 +34,10 @@ func TreeToDefinitions(tree Tree) ([]Definition, error) {
 		definition, next, _ := FindNextSpecialOrBinding(true, after, "record", "union", "alias", "func")
 		tree = next
 
+		if definition == nil {
+			return nil, &Error{at.SourceInfo(), fmt.Sprintf("missing %s definition", at.(*Special).Kind)}
+		}
+
 		switch at.(*Special).Kind {
 		case "record":
 			name, record, err := treeToRecord(definition)
@@ -68,10 +72,10 @@ func TreeToDefinitions(tree Tree) ([]Definition, error) {
 	return definitions, nil
 }
 
-func treeToTypeHeader(tree Tree) (name string, args []string, err error) {
+func treeToTypeHeader(definition, tree Tree) (name string, args []string, err error) {
 	header := Flatten(tree)
 	if len(header) == 0 {
-		return "", nil, &Error{tree.SourceInfo(), "missing type name"}
+		return "", nil, &Error{definition.SourceInfo(), "missing type name"}
 	}
 	nameLit, ok := header[0].(*Literal)
 	if !ok {
@@ -98,7 +102,7 @@ func treeToTypeHeader(tree Tree) (name string, args []string, err error) {
 func treeToRecord(tree Tree) (name string, record *types.Record, err error) {
 	headerTree, _, fieldsTree := FindNextSpecialOrBinding(false, tree, "=")
 
-	name, args, err := treeToTypeHeader(headerTree)
+	name, args, err := treeToTypeHeader(tree, headerTree)
 	if err != nil {
 		return "", nil, err
 	}
@@ -117,6 +121,12 @@ func treeToRecord(tree Tree) (name string, record *types.Record, err error) {
 		if err != nil {
 			return "", nil, err
 		}
+		if field == nil {
+			return "", nil, &Error{fieldTree.SourceInfo(), "missing record field"}
+		}
+		if err := definedHole(field); err != nil {
+			return "", nil, err
+		}
 		fieldVar, ok := field.(*expr.Var)
 		if !ok {
 			return "", nil, &Error{field.SourceInfo(), "record field must be simple variable"}
@@ -142,7 +152,7 @@ func treeToRecord(tree Tree) (name string, record *types.Record, err error) {
 func treeToUnion(tree Tree) (name string, union *types.Union, err error) {
 	headerTree, _, altsTree := FindNextSpecialOrBinding(false, tree, "=")
 
-	name, args, err := treeToTypeHeader(headerTree)
+	name, args, err := treeToTypeHeader(tree, headerTree)
 	if err != nil {
 		return "", nil, err
 	}
@@ -163,9 +173,15 @@ func treeToUnion(tree Tree) (name string, union *types.Union, err error) {
 		if err != nil {
 			return "", nil, err
 		}
+		if altNameExpr == nil {
+			return "", nil, &Error{altTree.SourceInfo(), "missing union alternative name"}
+		}
 		if altNameExpr.TypeInfo() != nil {
 			return "", nil, &Error{altNameExpr.SourceInfo(), "union alternative name cannot have type"}
 		}
+		if err := definedHole(altNameExpr); err != nil {
+			return "", nil, err
+		}
 		altNameVar, ok := altNameExpr.(*expr.Var)
 		if !ok {
 			return "", nil, &Error{altNameExpr.SourceInfo(), "union alternative name must be simple variable"}
@@ -178,6 +194,9 @@ func treeToUnion(tree Tree) (name string, union *types.Union, err error) {
 			if err != nil {
 				return "", nil, err
 			}
+			if field == nil {
+				return "", nil, &Error{altTree.SourceInfo(), "invalid union alternative field"}
+			}
 			fields = append(fields, field)
 		}
 
@@ -198,7 +217,7 @@ func treeToUnion(tree Tree) (name string, union *types.Union, err error) {
 func treeToAlias(tree Tree) (name string, alias *types.Alias, err error) {
 	headerTree, _, typeTree := FindNextSpecialOrBinding(false, tree, "=")
 
-	name, args, err := treeToTypeHeader(headerTree)
+	name, args, err := treeToTypeHeader(tree, headerTree)
 	if err != nil {
 		return "", nil, err
 	}
@@ -207,6 +226,9 @@ func treeToAlias(tree Tree) (name string, alias *types.Alias, err error) {
 	if err != nil {
 		return "", nil, err
 	}
+	if typ == nil {
+		return "", nil, &Error{tree.SourceInfo(), "missing aliased type"}
+	}
 
 	return name, &types.Alias{
 		SI:   tree.SourceInfo(),
@@ -229,6 +251,9 @@ func treeToFunc(tree Tree) (name string, body expr.Expr, err error) {
 	if err != nil {
 		return "", nil, err
 	}
+	if err := definedHole(sigExpr); err != nil {
+		return "", nil, err
+	}
 	signature, ok := sigExpr.(*expr.Var)
 	if !ok {
 		return "", nil, &Error{tree.SourceInfo(), "function name must be simple variable"}
@@ -245,6 +270,9 @@ func treeToFunc(tree Tree) (name string, body expr.Expr, err error) {
 	if err != nil {
 		return "", nil, err
 	}
+	if body == nil {
+		return "", nil, &Error{bodyTree.SourceInfo(), "missing function body"}
+	}
 
 	if body.TypeInfo() != nil && !body.TypeInfo().Equal(signature.TypeInfo()) {
 		return "", nil, &Error{
@@ -0,0 +1,30 @@
+package parse
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestHolesCantBeDefined(t *testing.T) {
+	tests := []string{
+		`func ?x : Int = 0`,
+		`func _? : Int = 0`,
+		`func f : Int -> Int = \?x 0`,
+		`record R = ?x : Int`,
+		`union U = ?x | y`,
+	}
+	for _, src := range tests {
+		tokens, err := Tokenize("test.fn", src)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = Definitions(tokens)
+		if err == nil {
+			t.Errorf("%s: expected an error", src)
+			continue
+		}
+		if msg := err.Error(); !strings.Contains(msg, "is a typed hole, it can't be defined") {
+			t.Errorf("%s: unexpected error: %s", src, msg)
+		}
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"math/big"
 	"strconv"
+	"strings"
 	"unicode"
 	"unicode/utf8"
 
@@ -38,6 +39,21 @@ func LiteralKindOf(s string) LiteralKind {
 	}
 }
 
+func IsHole(name string) bool {
+	if name == "_?" {
+		return true
+	}
+	return strings.HasPrefix(name, "?") && HasLetterOrDigit(name)
+}
+
+// definedHole returns an error if a hole is used as a name being defined, it could never be used
+func definedHole(e expr.Expr) error {
+	if hole, ok := e.(*expr.Hole); ok {
+		return &Error{hole.SourceInfo(), fmt.Sprintf("%s is a typed hole, it can't be defined", hole.Name)}
+	}
+	return nil
+}
+
 func Expr(tokens []Token) (expr.Expr, error) {
 	tree, err := MultiTree(tokens)
 	if err != nil {
@@ -73,6 +89,9 @@ func TreeToExpr(tree Tree) (expr.Expr, error) {
 		if err != nil {
 			return nil, err
 		}
+		if e == nil {
+			return nil, &Error{tree.SourceInfo(), "no expression before :"}
+		}
 		t, err := TreeToType(afterColon)
 		if err != nil {
 			return nil, err
@@ -84,6 +103,9 @@ func TreeToExpr(tree Tree) (expr.Expr, error) {
 	case *Literal:
 		switch LiteralKindOf(tree.Value) {
 		case LiteralIdentifier:
+			if IsHole(tree.Value) {
+				return &expr.Hole{SI: tree.SourceInfo(), Name: tree.Value}, nil
+			}
 			return &expr.Var{SI: tree.SourceInfo(), Name: tree.Value}, nil
 		case LiteralNumber:
 			i := big.NewInt(0)
@@ -101,8 +123,11 @@ func TreeToExpr(tree Tree) (expr.Expr, error) {
 			if err != nil {
 				return nil, &Error{tree.SourceInfo(), err.Error()}
 			}
-			r := []rune(s)[0] // has only one rune, no need to check
-			return &expr.Char{SI: tree.SourceInfo(), Value: r}, nil
+			r := []rune(s)
+			if len(r) != 1 {
+				return nil, &Error{tree.SourceInfo(), "character literal must contain exactly one character"}
+			}
+			return &expr.Char{SI: tree.SourceInfo(), Value: r[0]}, nil
 		case LiteralString:
 			s, err := strconv.Unquote(tree.Value)
 			if err != nil {
@@ -137,6 +162,9 @@ func TreeToExpr(tree Tree) (expr.Expr, error) {
 			for inside != nil {
 				elemTree, _, after := FindNextSpecialOrBinding(true, inside, ",")
 				inside = after
+				if elemTree == nil {
+					return nil, &Error{tree.SourceInfo(), "empty list element"}
+				}
 				elem, err := TreeToExpr(elemTree)
 				if err != nil {
 					return nil, err
@@ -179,6 +207,9 @@ func TreeToExpr(tree Tree) (expr.Expr, error) {
 				if err != nil {
 					return nil, err
 				}
+				if altExpr == nil {
+					return nil, &Error{caseBinding.SourceInfo(), "no union alternative after case"}
+				}
 				alt, ok := altExpr.(*expr.Var)
 				if !ok {
 					return nil, &Error{altExpr.SourceInfo(), "union alternative must be a simple variable"}
@@ -191,6 +222,9 @@ func TreeToExpr(tree Tree) (expr.Expr, error) {
 				if err != nil {
 					return nil, err
 				}
+				if body == nil {
+					return nil, &Error{caseBinding.SourceInfo(), fmt.Sprintf("no expression after case %s", alt.Name)}
+				}
 
 				sw.Cases = append(sw.Cases, struct {
 					SI   *parseinfo.Source
@@ -221,6 +255,9 @@ func TreeToExpr(tree Tree) (expr.Expr, error) {
 			if err != nil {
 				return nil, err
 			}
+			if err := definedHole(bound); err != nil {
+				return nil, err
+			}
 			boundVar, ok := bound.(*expr.Var)
 			if !ok {
 				return nil, &Error{tree.SourceInfo(), "bound expression must be a simple variable"}
@@ -0,0 +1,55 @@
+package parse
+
+import (
+	"strings"
+	"testing"
+)
+
+// fuzzSeeds are the seed corpus of the fuzz tests, including inputs that used to crash
+var fuzzSeeds = []string{
+	`func main : String = "Hello, world!"`,
+	`func f : Int -> Int = \x x + 1`,
+	`record Point = x : Int, y : Int`,
+	`union Maybe a = none | some a`,
+	`alias Name = String`,
+	`func g : List Int = [1, 2, 3]`,
+	`func h : Int = switch [1] case empty 0 case (::) \x \xs x`,
+	`func A : A =[,]`,
+	`func A : A =[1,,2]`,
+	`func A : a = switch 0 case A case A 0`,
+	`func A : a = switch 0 case`,
+}
+
+func FuzzDefinitions(f *testing.F) {
+	for _, seed := range fuzzSeeds {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, src string) {
+		tokens, err := Tokenize("fuzz.fn", src)
+		if err != nil {
+			return
+		}
+		Definitions(tokens)
+	})
+}
+
+func TestMalformedExpressions(t *testing.T) {
+	tests := []struct {
+		src string
+		err string
+	}{
+		{`func A : A =[,]`, "test.fn:1:13: empty list element"},
+		{`func A : A =[1,,2]`, "test.fn:1:13: empty list element"},
+		{`func A : a = switch 0 case A case A 0`, "no expression after case A"},
+	}
+	for _, test := range tests {
+		tokens, err := Tokenize("test.fn", test.src)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = Definitions(tokens)
+		if err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("%s: got error %v, want %s", test.src, err, test.err)
+		}
+	}
+}
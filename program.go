@@ -0,0 +1,435 @@
+package funky
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sort"
+
+	"github.com/faiface/funky/compile"
+	"github.com/faiface/funky/parse"
+	"github.com/faiface/funky/parse/parseinfo"
+	"github.com/faiface/funky/types"
+
+	cxr "github.com/faiface/crux/runtime"
+)
+
+const (
+	programMagic   = "FUNKYFNC"
+	programVersion = 2
+)
+
+// tags of literal values stored in codes
+const (
+	valueNone byte = iota
+	valueChar
+	valueInt
+	valueFloat
+)
+
+type program struct {
+	globalIndices map[string][]int32
+	globalValues  []cxr.Value
+	codeIndices   map[string][]int32
+	codes         []cxr.Code
+
+	sourceInfos map[string][]*parseinfo.Source
+	typeInfos   map[string][]string
+	sources     *compile.SourceTable
+	unions      map[string]*types.Union
+
+	compileStats *compile.Stats // nil for loaded programs
+}
+
+func compileProgram(env *compile.Env, main string) (*program, []error) {
+	globalIndices, globalValues, codeIndices, codes, sources, errs := env.Compile(main)
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	stats := env.Stats()
+	prog := &program{
+		globalIndices: globalIndices,
+		globalValues:  globalValues,
+		codeIndices:   codeIndices,
+		codes:         codes,
+		sourceInfos:   make(map[string][]*parseinfo.Source),
+		typeInfos:     make(map[string][]string),
+		sources:       sources,
+		unions:        env.Unions(),
+		compileStats:  &stats,
+	}
+	for name := range globalIndices {
+		for i := range globalIndices[name] {
+			prog.sourceInfos[name] = append(prog.sourceInfos[name], env.SourceInfo(name, i))
+			prog.typeInfos[name] = append(prog.typeInfos[name], env.TypeInfo(name, i).String())
+		}
+	}
+	return prog, nil
+}
+
+func saveProgram(path string, prog *program) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	err = writeProgram(w, prog)
+	if err == nil {
+		err = w.Flush()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+func loadProgram(path string) (*program, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	prog, err := readProgram(bufio.NewReader(f))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", path, err)
+	}
+	return prog, nil
+}
+
+// The format is:
+//
+//   magic, version
+//   number of names, then for each name (sorted):
+//     name, number of overloads, then for each overload:
+//       global index, code index, source file, line, column, type
+//   number of codes, then each code recursively:
+//     kind, x, value tag, value, number of subcodes, subcodes
+//   number of unions, then for each union (sorted):
+//     name, number of args, args, number of alternatives, then for each alternative:
+//       name, number of fields, types of fields
+//
+// Integers are varints, strings are prefixed by their length.
+
+func writeProgram(w io.Writer, prog *program) error {
+	enc := &encoder{w: w}
+
+	enc.bytes([]byte(programMagic))
+	enc.uint(programVersion)
+
+	var names []string
+	for name := range prog.globalIndices {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	enc.uint(uint64(len(names)))
+	for _, name := range names {
+		enc.string(name)
+		enc.uint(uint64(len(prog.globalIndices[name])))
+		for i := range prog.globalIndices[name] {
+			enc.int(int64(prog.globalIndices[name][i]))
+			enc.int(int64(prog.codeIndices[name][i]))
+			si := prog.sourceInfos[name][i]
+			if si == nil {
+				si = &parseinfo.Source{}
+			}
+			enc.string(si.Filename)
+			enc.int(int64(si.Line))
+			enc.int(int64(si.Column))
+			enc.string(prog.typeInfos[name][i])
+		}
+	}
+
+	enc.uint(uint64(len(prog.codes)))
+	for i := range prog.codes {
+		enc.code(&prog.codes[i])
+	}
+
+	var unionNames []string
+	for name := range prog.unions {
+		unionNames = append(unionNames, name)
+	}
+	sort.Strings(unionNames)
+
+	enc.uint(uint64(len(unionNames)))
+	for _, name := range unionNames {
+		union := prog.unions[name]
+		enc.string(name)
+		enc.uint(uint64(len(union.Args)))
+		for _, arg := range union.Args {
+			enc.string(arg)
+		}
+		enc.uint(uint64(len(union.Alts)))
+		for _, alt := range union.Alts {
+			enc.string(alt.Name)
+			enc.uint(uint64(len(alt.Fields)))
+			for _, field := range alt.Fields {
+				enc.string(field.String())
+			}
+		}
+	}
+
+	return enc.err
+}
+
+func readProgram(r io.ByteReader) (*program, error) {
+	dec := &decoder{r: r}
+
+	if string(dec.bytes(len(programMagic))) != programMagic {
+		if dec.err != nil {
+			return nil, dec.err
+		}
+		return nil, errors.New("not a compiled funky program")
+	}
+	if version := dec.uint(); dec.err == nil && version != programVersion {
+		return nil, fmt.Errorf("unsupported compiled program version: %d", version)
+	}
+
+	prog := &program{
+		globalIndices: make(map[string][]int32),
+		codeIndices:   make(map[string][]int32),
+		sourceInfos:   make(map[string][]*parseinfo.Source),
+		typeInfos:     make(map[string][]string),
+		unions:        make(map[string]*types.Union),
+	}
+
+	numGlobals := 0
+	numNames := dec.uint()
+	for i := uint64(0); i < numNames && dec.err == nil; i++ {
+		name := dec.string()
+		numOverloads := dec.uint()
+		for j := uint64(0); j < numOverloads && dec.err == nil; j++ {
+			globalIndex := int32(dec.int())
+			codeIndex := int32(dec.int())
+			si := &parseinfo.Source{
+				Filename: dec.string(),
+				Line:     int(dec.int()),
+				Column:   int(dec.int()),
+			}
+			if *si == (parseinfo.Source{}) {
+				si = nil
+			}
+			typ := dec.string()
+
+			prog.globalIndices[name] = append(prog.globalIndices[name], globalIndex)
+			prog.codeIndices[name] = append(prog.codeIndices[name], codeIndex)
+			prog.sourceInfos[name] = append(prog.sourceInfos[name], si)
+			prog.typeInfos[name] = append(prog.typeInfos[name], typ)
+
+			if globalIndex >= 0 {
+				numGlobals++
+			}
+		}
+	}
+
+	// the counts aren't trusted, the slices grow as their elements get read
+	numCodes := dec.uint()
+	if dec.err == nil && numCodes > math.MaxInt32 {
+		return nil, errors.New("too many codes")
+	}
+	for i := uint64(0); i < numCodes && dec.err == nil; i++ {
+		prog.codes = append(prog.codes, dec.code())
+	}
+
+	numUnions := dec.uint()
+	for i := uint64(0); i < numUnions && dec.err == nil; i++ {
+		name := dec.string()
+		union := &types.Union{}
+		numArgs := dec.uint()
+		for j := uint64(0); j < numArgs && dec.err == nil; j++ {
+			union.Args = append(union.Args, dec.string())
+		}
+		numAlts := dec.uint()
+		for j := uint64(0); j < numAlts && dec.err == nil; j++ {
+			alt := types.Alternative{Name: dec.string()}
+			numFields := dec.uint()
+			for k := uint64(0); k < numFields && dec.err == nil; k++ {
+				alt.Fields = append(alt.Fields, dec.typ())
+			}
+			union.Alts = append(union.Alts, alt)
+		}
+		prog.unions[name] = union
+	}
+
+	if dec.err != nil {
+		return nil, dec.err
+	}
+
+	// global values are unevaluated thunks of their codes, just like crux.Compile makes them,
+	// each overload that isn't pruned has its own global index
+	prog.globalValues = make([]cxr.Value, numGlobals)
+	for name := range prog.globalIndices {
+		for i, globalIndex := range prog.globalIndices[name] {
+			codeIndex := prog.codeIndices[name][i]
+			if globalIndex < 0 && codeIndex < 0 {
+				continue // pruned
+			}
+			if globalIndex < 0 || int(globalIndex) >= numGlobals || prog.globalValues[globalIndex] != nil ||
+				codeIndex < 0 || int(codeIndex) >= len(prog.codes) {
+				return nil, fmt.Errorf("invalid index of %s/%d", name, i)
+			}
+			prog.globalValues[globalIndex] = &cxr.Thunk{Code: &prog.codes[codeIndex]}
+		}
+	}
+	prog.sources = compile.NewSourceTable(prog.globalIndices, prog.codeIndices, prog.codes, prog.sourceInfos)
+
+	return prog, nil
+}
+
+type encoder struct {
+	w   io.Writer
+	buf [binary.MaxVarintLen64]byte
+	err error
+}
+
+func (enc *encoder) bytes(b []byte) {
+	if enc.err != nil {
+		return
+	}
+	_, enc.err = enc.w.Write(b)
+}
+
+func (enc *encoder) uint(x uint64) {
+	n := binary.PutUvarint(enc.buf[:], x)
+	enc.bytes(enc.buf[:n])
+}
+
+func (enc *encoder) int(x int64) {
+	n := binary.PutVarint(enc.buf[:], x)
+	enc.bytes(enc.buf[:n])
+}
+
+func (enc *encoder) string(s string) {
+	enc.uint(uint64(len(s)))
+	enc.bytes([]byte(s))
+}
+
+func (enc *encoder) code(code *cxr.Code) {
+	enc.uint(uint64(code.Kind))
+	enc.int(int64(code.X))
+
+	switch value := code.Value.(type) {
+	case nil:
+		enc.bytes([]byte{valueNone})
+	case *cxr.Char:
+		enc.bytes([]byte{valueChar})
+		enc.int(int64(value.Value))
+	case *cxr.Int:
+		enc.bytes([]byte{valueInt})
+		b, err := value.Value.GobEncode()
+		if err != nil && enc.err == nil {
+			enc.err = err
+		}
+		enc.string(string(b))
+	case *cxr.Float:
+		enc.bytes([]byte{valueFloat})
+		enc.uint(math.Float64bits(value.Value))
+	default:
+		if enc.err == nil {
+			enc.err = fmt.Errorf("cannot save value of type %T", value)
+		}
+	}
+
+	enc.uint(uint64(len(code.Table)))
+	for i := range code.Table {
+		enc.code(&code.Table[i])
+	}
+}
+
+type decoder struct {
+	r   io.ByteReader
+	err error
+}
+
+func (dec *decoder) bytes(n int) []byte {
+	b := make([]byte, n)
+	for i := range b {
+		if dec.err != nil {
+			return nil
+		}
+		b[i], dec.err = dec.r.ReadByte()
+	}
+	return b
+}
+
+func (dec *decoder) uint() uint64 {
+	if dec.err != nil {
+		return 0
+	}
+	var x uint64
+	x, dec.err = binary.ReadUvarint(dec.r)
+	return x
+}
+
+func (dec *decoder) int() int64 {
+	if dec.err != nil {
+		return 0
+	}
+	var x int64
+	x, dec.err = binary.ReadVarint(dec.r)
+	return x
+}
+
+func (dec *decoder) string() string {
+	n := dec.uint()
+	if dec.err == nil && n > 1<<24 {
+		dec.err = errors.New("string too long")
+	}
+	return string(dec.bytes(int(n)))
+}
+
+func (dec *decoder) typ() types.Type {
+	s := dec.string()
+	if dec.err != nil {
+		return nil
+	}
+	tokens, err := parse.Tokenize("", s)
+	if err != nil {
+		dec.err = err
+		return nil
+	}
+	t, err := parse.Type(tokens)
+	if err == nil && t == nil {
+		err = errors.New("missing type")
+	}
+	if err != nil {
+		dec.err = err
+		return nil
+	}
+	return t
+}
+
+func (dec *decoder) code() cxr.Code {
+	var code cxr.Code
+
+	code.Kind = cxr.CodeKind(dec.uint())
+	code.X = int32(dec.int())
+
+	switch tag := dec.bytes(1); {
+	case dec.err != nil:
+	case tag[0] == valueNone:
+	case tag[0] == valueChar:
+		code.Value = &cxr.Char{Value: rune(dec.int())}
+	case tag[0] == valueInt:
+		var i cxr.Int
+		if err := i.Value.GobDecode([]byte(dec.string())); err != nil && dec.err == nil {
+			dec.err = err
+		}
+		code.Value = &i
+	case tag[0] == valueFloat:
+		code.Value = &cxr.Float{Value: math.Float64frombits(dec.uint())}
+	default:
+		dec.err = fmt.Errorf("invalid value tag: %d", tag[0])
+	}
+
+	numTable := dec.uint()
+	for i := uint64(0); i < numTable && dec.err == nil; i++ {
+		code.Table = append(code.Table, dec.code())
+	}
+
+	return code
+}
@@ -0,0 +1,130 @@
+package funky
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/faiface/funky/runtime"
+)
+
+func TestProgramRoundTrip(t *testing.T) {
+	const src = `
+func fact : Int -> Int = \n if (n <= 1) 1 (n * fact (n - 1))
+func main : String = string (fact 20) ++ " " ++ string 2.5 ++ " " ++ ['x', 'y']
+`
+	compiled, errs := compileProgram(testEnv(t, src), "main")
+	for _, err := range errs {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := writeProgram(&buf, compiled); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := readProgram(bufio.NewReader(&buf))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	run := func(prog *program) string {
+		t.Helper()
+		s, err := runtime.NewProgram(prog.globalValues).Global(prog.globalIndices["main"][0]).TryString()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s
+	}
+	want := "2432902008176640000 2.5 xy"
+	if got := run(compiled); got != want {
+		t.Errorf("compiled program: got %q, want %q", got, want)
+	}
+	if got := run(loaded); got != want {
+		t.Errorf("loaded program: got %q, want %q", got, want)
+	}
+	if got, want := loaded.typeInfos["main"][0], compiled.typeInfos["main"][0]; got != want {
+		t.Errorf("loaded type of main: got %q, want %q", got, want)
+	}
+}
+
+func TestProgramVersion(t *testing.T) {
+	header := []byte(programMagic)
+	header = append(header, make([]byte, binary.MaxVarintLen64)...)
+	n := binary.PutUvarint(header[len(programMagic):], 1)
+	header = header[:len(programMagic)+n]
+
+	_, err := readProgram(bufio.NewReader(bytes.NewReader(header)))
+	if err == nil || !strings.Contains(err.Error(), "unsupported compiled program version: 1") {
+		t.Fatalf("got error %v, want unsupported version 1", err)
+	}
+}
+
+func TestPanicLocation(t *testing.T) {
+	prog, errs := compileProgram(testEnv(t, `func main : Int = first! (rest! [1])`), "main")
+	for _, err := range errs {
+		t.Fatal(err)
+	}
+	main := prog.globalValues[prog.globalIndices["main"][0]]
+	frame, ok := prog.sources.Origin(main)
+	if !ok || frame.Name != "main" {
+		t.Errorf("got origin %v, want main", frame)
+	}
+
+	_, err := runtime.NewProgram(prog.globalValues).Global(prog.globalIndices["main"][0]).TryInt()
+	// the location of the call to panic, which is in the standard library
+	want := "stdlib/list.fn:19:"
+	if err == nil || !strings.HasPrefix(err.Error(), want) || !strings.HasSuffix(err.Error(), "first!: empty list") {
+		t.Errorf("got error %v, want a panic at %s", err, want)
+	}
+}
+
+func TestProgramCorrupt(t *testing.T) {
+	compiled, errs := compileProgram(testEnv(t, `func main : Int = 1 + 2`), "main")
+	for _, err := range errs {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := writeProgram(&buf, compiled); err != nil {
+		t.Fatal(err)
+	}
+	for n := 0; n < buf.Len(); n++ {
+		if _, err := readProgram(bufio.NewReader(bytes.NewReader(buf.Bytes()[:n]))); err == nil {
+			t.Fatalf("read a program truncated to %d of %d bytes", n, buf.Len())
+		}
+	}
+
+	// a program with the header of the given counts and indices, and nothing else
+	corrupt := func(numCodes uint64, globalIndex int64) []byte {
+		enc := &encoder{w: new(bytes.Buffer)}
+		enc.bytes([]byte(programMagic))
+		enc.uint(programVersion)
+		enc.uint(1)
+		enc.string("main")
+		enc.uint(1)
+		enc.int(globalIndex)
+		enc.int(0)
+		enc.string("")
+		enc.int(0)
+		enc.int(0)
+		enc.string("Int")
+		enc.uint(numCodes)
+		return enc.w.(*bytes.Buffer).Bytes()
+	}
+	tests := []struct {
+		name    string
+		program []byte
+		err     string
+	}{
+		{"huge number of codes", corrupt(math.MaxInt32, 0), "EOF"},
+		{"too many codes", corrupt(math.MaxInt32+1, 0), "too many codes"},
+		{"huge global index", append(corrupt(1, 1<<30), 0, 0, valueNone, 0, 0), "invalid index of main/0"},
+	}
+	for _, test := range tests {
+		_, err := readProgram(bufio.NewReader(bytes.NewReader(test.program)))
+		if err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("%s: got error %v, want %q", test.name, err, test.err)
+		}
+	}
+}
@@ -0,0 +1,399 @@
+package funky
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+	"math/rand"
+	"strconv"
+	"strings"
+
+	"github.com/faiface/funky/compile"
+	"github.com/faiface/funky/runtime"
+	"github.com/faiface/funky/types"
+)
+
+const (
+	maxSampleSize = 30   // depth of the generated values, grows with the number of the run
+	maxShrinks    = 1000 // number of successful shrinking steps before giving up
+)
+
+// sample is a generated value of a property argument. It's kept apart from the runtime value,
+// so that it can be shrunk and printed.
+type sample struct {
+	typ    types.Type // with aliases expanded
+	char   rune
+	int    *big.Int
+	float  float64
+	alt    int
+	fields []*sample
+}
+
+type sampler struct {
+	env *compile.Env
+	rnd *rand.Rand
+}
+
+// propParams returns the types of the arguments of a property, which is a function returning Bool.
+// Type variables get replaced by Int.
+func propParams(t types.Type) (params []types.Type, ok bool) {
+	t = t.Map(func(t types.Type) types.Type {
+		if _, ok := t.(*types.Var); ok {
+			return &types.Appl{Name: "Int"}
+		}
+		return t
+	})
+	for {
+		f, ok := t.(*types.Func)
+		if !ok {
+			break
+		}
+		params = append(params, f.From)
+		t = f.To
+	}
+	result, ok := t.(*types.Appl)
+	return params, len(params) > 0 && ok && result.Name == "Bool" && len(result.Args) == 0
+}
+
+// expand expands aliases until the type is a builtin, a record or a union
+func (g *sampler) expand(t types.Type) (*types.Appl, types.Name, error) {
+	for {
+		appl, ok := t.(*types.Appl)
+		if !ok {
+			return nil, nil, fmt.Errorf("cannot generate values of type %v", t)
+		}
+		switch name := g.env.TypeName(appl.Name).(type) {
+		case nil:
+			return nil, nil, fmt.Errorf("unknown type: %s", appl.Name)
+		case *types.Alias:
+			t = substitute(name.Type, name.Args, appl.Args)
+		default:
+			return appl, name, nil
+		}
+	}
+}
+
+func substitute(t types.Type, params []string, args []types.Type) types.Type {
+	return t.Map(func(t types.Type) types.Type {
+		if v, ok := t.(*types.Var); ok {
+			for i := range params {
+				if params[i] == v.Name {
+					return args[i]
+				}
+			}
+		}
+		return t
+	})
+}
+
+func (g *sampler) generate(t types.Type, size int) (*sample, error) {
+	appl, name, err := g.expand(t)
+	if err != nil {
+		return nil, err
+	}
+	s := &sample{typ: appl}
+	if size < 0 {
+		size = 0
+	}
+
+	switch name := name.(type) {
+	case *types.Builtin:
+		switch appl.Name {
+		case "Int":
+			s.int = big.NewInt(g.rnd.Int63n(int64(2*size+1)) - int64(size))
+		case "Char":
+			if g.rnd.Intn(4) == 0 {
+				s.char = rune(g.rnd.Intn(0x3000))
+			} else {
+				s.char = rune(' ' + g.rnd.Intn('~'-' '+1))
+			}
+		case "Float":
+			s.float = (g.rnd.Float64()*2 - 1) * float64(size)
+		default:
+			return nil, fmt.Errorf("cannot generate values of type %v", t)
+		}
+
+	case *types.Record:
+		for _, field := range name.Fields {
+			if strings.HasPrefix(field.Name, "_") {
+				return nil, fmt.Errorf("cannot generate values of type %v, its fields are private", t)
+			}
+		}
+		for _, field := range name.Fields {
+			f, err := g.generate(substitute(field.Type, name.Args, appl.Args), size)
+			if err != nil {
+				return nil, err
+			}
+			s.fields = append(s.fields, f)
+		}
+
+	case *types.Union:
+		if len(name.Alts) == 0 {
+			return nil, fmt.Errorf("cannot generate values of empty type %v", t)
+		}
+		for _, alt := range name.Alts {
+			if strings.HasPrefix(alt.Name, "_") {
+				return nil, fmt.Errorf("cannot generate values of type %v, its constructors are private", t)
+			}
+		}
+		s.alt = g.alternative(name, size)
+		// the size gets split among the structured fields, so that trees don't explode
+		var (
+			fields     []types.Type
+			structured = 0
+		)
+		for _, field := range name.Alts[s.alt].Fields {
+			field = substitute(field, name.Args, appl.Args)
+			if _, def, err := g.expand(field); err == nil {
+				if _, ok := def.(*types.Builtin); !ok {
+					structured++
+				}
+			}
+			fields = append(fields, field)
+		}
+		fieldSize := size - 1
+		if structured > 1 {
+			fieldSize = size / structured
+		}
+		for _, field := range fields {
+			f, err := g.generate(field, fieldSize)
+			if err != nil {
+				return nil, err
+			}
+			s.fields = append(s.fields, f)
+		}
+	}
+
+	return s, nil
+}
+
+// alternative prefers alternatives with fields while the size allows, so that recursive types
+// like lists grow long enough, and the ones with the fewest fields when it doesn't, so that they end
+func (g *sampler) alternative(union *types.Union, size int) int {
+	if size <= 0 {
+		smallest := 0
+		for i, alt := range union.Alts {
+			if len(alt.Fields) < len(union.Alts[smallest].Fields) {
+				smallest = i
+			}
+		}
+		return smallest
+	}
+	var withFields []int
+	for i, alt := range union.Alts {
+		if len(alt.Fields) > 0 {
+			withFields = append(withFields, i)
+		}
+	}
+	if len(withFields) == 0 || g.rnd.Intn(4) == 0 {
+		return g.rnd.Intn(len(union.Alts))
+	}
+	return withFields[g.rnd.Intn(len(withFields))]
+}
+
+func (s *sample) value() *runtime.Value {
+	switch s.typ.(*types.Appl).Name {
+	case "Int":
+		return runtime.MkInt(s.int)
+	case "Char":
+		return runtime.MkChar(s.char)
+	case "Float":
+		return runtime.MkFloat(s.float)
+	}
+	fields := make([]*runtime.Value, len(s.fields))
+	for i := range fields {
+		fields[i] = s.fields[i].value()
+	}
+	return runtime.MkUnion(s.alt, fields...)
+}
+
+// shrinks returns smaller variants of the sample, the simplest ones first
+func (s *sample) shrinks() []*sample {
+	var shrinks []*sample
+	switch s.typ.(*types.Appl).Name {
+	case "Char":
+		for _, c := range []rune{'a', ' '} {
+			if s.char > c {
+				shrinks = append(shrinks, &sample{typ: s.typ, char: c})
+			}
+		}
+		return shrinks
+	case "Int":
+		if s.int.Sign() == 0 {
+			return nil
+		}
+		half := new(big.Int).Quo(s.int, big.NewInt(2))
+		shrinks = append(shrinks, &sample{typ: s.typ, int: new(big.Int)})
+		if half.Sign() != 0 {
+			shrinks = append(shrinks, &sample{typ: s.typ, int: half})
+		}
+		if s.int.Sign() < 0 {
+			shrinks = append(shrinks, &sample{typ: s.typ, int: new(big.Int).Neg(s.int)})
+		}
+		towards := new(big.Int).Sub(s.int, big.NewInt(int64(s.int.Sign())))
+		if towards.Sign() != 0 && towards.Cmp(half) != 0 {
+			shrinks = append(shrinks, &sample{typ: s.typ, int: towards})
+		}
+		return shrinks
+	case "Float":
+		if s.float == 0 {
+			return nil
+		}
+		shrinks = append(shrinks, &sample{typ: s.typ, float: 0})
+		if t := math.Trunc(s.float); t != s.float {
+			shrinks = append(shrinks, &sample{typ: s.typ, float: t})
+		}
+		if s.float/2 != 0 {
+			shrinks = append(shrinks, &sample{typ: s.typ, float: s.float / 2})
+		}
+		return shrinks
+	}
+
+	// a structure shrinks to its parts of the same type, or by shrinking one of its fields
+	for _, field := range s.fields {
+		if field.typ.Equal(s.typ) {
+			shrinks = append(shrinks, field)
+		}
+	}
+	for i, field := range s.fields {
+		for _, shrunk := range field.shrinks() {
+			fields := make([]*sample, len(s.fields))
+			copy(fields, s.fields)
+			fields[i] = shrunk
+			shrinks = append(shrinks, &sample{typ: s.typ, alt: s.alt, fields: fields})
+		}
+	}
+	return shrinks
+}
+
+// format prints the sample the way it would be written in Funky
+func (g *sampler) format(s *sample) string {
+	appl := s.typ.(*types.Appl)
+	switch appl.Name {
+	case "Int":
+		return s.int.String()
+	case "Char":
+		return strconv.QuoteRune(s.char)
+	case "Float":
+		return formatFloat(s.float)
+	case "List":
+		var (
+			elems []string
+			chars []rune
+		)
+		isString := false
+		if elem, ok := appl.Args[0].(*types.Appl); ok && elem.Name == "Char" {
+			isString = true
+		}
+		for ; s.alt != 0; s = s.fields[1] {
+			elems = append(elems, g.format(s.fields[0]))
+			if isString {
+				chars = append(chars, s.fields[0].char)
+			}
+		}
+		if isString {
+			return strconv.Quote(string(chars))
+		}
+		return "[" + strings.Join(elems, ", ") + "]"
+	}
+
+	var constructor string
+	switch name := g.env.TypeName(appl.Name).(type) {
+	case *types.Record:
+		constructor = appl.Name
+	case *types.Union:
+		constructor = name.Alts[s.alt].Name
+	}
+	if len(s.fields) == 0 {
+		return constructor
+	}
+	parts := []string{constructor}
+	for _, field := range s.fields {
+		parts = append(parts, g.format(field))
+	}
+	return "(" + strings.Join(parts, " ") + ")"
+}
+
+// formatFloat prints the float as a literal that doesn't parse as an Int, or as the name of the
+// builtin constant if there's no literal for it
+func formatFloat(f float64) string {
+	switch {
+	case math.IsNaN(f):
+		return "nan"
+	case math.IsInf(f, +1):
+		return "+inf"
+	case math.IsInf(f, -1):
+		return "-inf"
+	}
+	s := strconv.FormatFloat(f, 'g', -1, 64)
+	if !strings.ContainsAny(s, ".e") {
+		s += ".0"
+	}
+	return s
+}
+
+// checkProperty applies the property to random arguments and shrinks the first counterexample.
+// It returns an empty message if the property holds in all the runs.
+func checkProperty(env *compile.Env, property *runtime.Value, params []types.Type, seed int64, runs int) (message string, err error) {
+	g := &sampler{env: env, rnd: rand.New(rand.NewSource(seed))}
+
+	for run := 0; run < runs; run++ {
+		size := run * maxSampleSize / runs
+		args := make([]*sample, len(params))
+		for i := range params {
+			args[i], err = g.generate(params[i], size)
+			if err != nil {
+				return "", err
+			}
+		}
+		if holds(property, args) {
+			continue
+		}
+
+		for shrinks := 0; shrinks < maxShrinks; shrinks++ {
+			shrunk := false
+			for i := range args {
+				for _, arg := range args[i].shrinks() {
+					smaller := make([]*sample, len(args))
+					copy(smaller, args)
+					smaller[i] = arg
+					if !holds(property, smaller) {
+						args, shrunk = smaller, true
+						break
+					}
+				}
+				if shrunk {
+					break
+				}
+			}
+			if !shrunk {
+				break
+			}
+		}
+
+		var formatted []string
+		for _, arg := range args {
+			formatted = append(formatted, g.format(arg))
+		}
+		return fmt.Sprintf("failed after %d runs (seed %d) on: %s", run+1, seed, strings.Join(formatted, " ")), nil
+	}
+
+	return "", nil
+}
+
+// holds tells whether the property returns true for the arguments, a panic counts as false
+func holds(property *runtime.Value, args []*sample) (ok bool) {
+	defer func() {
+		if r := recover(); r != nil {
+			if _, isErr := r.(*runtime.Error); !isErr {
+				panic(r)
+			}
+			ok = false
+		}
+	}()
+	values := make([]*runtime.Value, len(args))
+	for i := range args {
+		values[i] = args[i].value()
+	}
+	return property.Apply(values...).Bool()
+}
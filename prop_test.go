@@ -0,0 +1,156 @@
+package funky
+
+import (
+	"math"
+	"math/big"
+	"math/rand"
+	"regexp"
+	"testing"
+
+	"github.com/faiface/funky/expr"
+	"github.com/faiface/funky/parse"
+	"github.com/faiface/funky/types"
+)
+
+func TestFormat(t *testing.T) {
+	env := testEnv(t, "")
+	g := &sampler{env: env}
+	list := func(typ types.Type, elems ...*sample) *sample {
+		s := &sample{typ: &types.Appl{Name: "List", Args: []types.Type{typ}}}
+		for i := len(elems) - 1; i >= 0; i-- {
+			s = &sample{typ: s.typ, alt: 1, fields: []*sample{elems[i], s}}
+		}
+		return s
+	}
+	var (
+		intType   = &types.Appl{Name: "Int"}
+		charType  = &types.Appl{Name: "Char"}
+		floatType = &types.Appl{Name: "Float"}
+		integer   = func(i int64) *sample { return &sample{typ: intType, int: big.NewInt(i)} }
+		char      = func(c rune) *sample { return &sample{typ: charType, char: c} }
+		float     = func(f float64) *sample { return &sample{typ: floatType, float: f} }
+	)
+
+	tests := []struct {
+		sample *sample
+		want   string
+	}{
+		{integer(-7), "-7"},
+		{float(3), "3.0"},
+		{float(-0.5), "-0.5"},
+		{float(1e21), "1e+21"},
+		{float(math.NaN()), "nan"},
+		{float(math.Inf(-1)), "-inf"},
+		{char('a'), "'a'"},
+		{char('\''), `'\''`},
+		{char('\n'), `'\n'`},
+		{list(intType), "[]"},
+		{list(intType, integer(1), integer(-2)), "[1, -2]"},
+		{list(floatType, float(1), float(2.5)), "[1.0, 2.5]"},
+		{list(charType, char('h'), char('"')), `"h\""`},
+		{&sample{typ: &types.Appl{Name: "Maybe", Args: []types.Type{intType}}, alt: 1, fields: []*sample{integer(3)}}, "(some 3)"},
+		{&sample{typ: &types.Appl{Name: "Maybe", Args: []types.Type{intType}}}, "none"},
+	}
+	for _, test := range tests {
+		if got := g.format(test.sample); got != test.want {
+			t.Errorf("got %s, want %s", got, test.want)
+		}
+	}
+
+	// the literals parse back to the same values
+	for _, f := range []float64{0, 3, -0.25, 1e-7, 123456789012, 1e300} {
+		e := parseExpr(t, formatFloat(f))
+		if lit, ok := e.(*expr.Float); !ok || lit.Value != f {
+			t.Errorf("%v: parsed as %v", f, e)
+		}
+	}
+	for _, c := range []rune{'a', '\'', '\\', '"', '\n', 0, 0x2028, 'ž'} {
+		e := parseExpr(t, g.format(char(c)))
+		if lit, ok := e.(*expr.Char); !ok || lit.Value != c {
+			t.Errorf("%q: parsed as %v", c, e)
+		}
+	}
+}
+
+func parseExpr(t *testing.T, src string) expr.Expr {
+	t.Helper()
+	tokens, err := parse.Tokenize("test.fn", src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e, err := parse.Expr(tokens)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return e
+}
+
+func TestGenerate(t *testing.T) {
+	env := testEnv(t, "")
+	intType := &types.Appl{Name: "Int"}
+	listType := &types.Appl{Name: "List", Args: []types.Type{intType}}
+	for _, size := range []int{0, 1, 10, 30} {
+		g := &sampler{env: env, rnd: rand.New(rand.NewSource(1))}
+		for run := 0; run < 20; run++ {
+			s, err := g.generate(listType, size)
+			if err != nil {
+				t.Fatal(err)
+			}
+			length := 0
+			for ; s.alt != 0; s = s.fields[1] {
+				length++
+				if i := s.fields[0].int.Int64(); i < -int64(size) || i > int64(size) {
+					t.Errorf("size %d: element %d out of range", size, i)
+				}
+			}
+			if length > size {
+				t.Errorf("size %d: got %d elements", size, length)
+			}
+		}
+	}
+
+	for _, typ := range []types.Type{
+		&types.Func{From: intType, To: intType},
+		&types.Appl{Name: "Vector", Args: []types.Type{intType}},
+	} {
+		if _, err := (&sampler{env: env}).generate(typ, 1); err == nil {
+			t.Errorf("%v: generated a value", typ)
+		}
+	}
+}
+
+func TestCheckProperty(t *testing.T) {
+	env := testEnv(t, `
+func prop-short : List Int -> Bool = \xs length xs < 3
+func prop-small : List Int -> Bool = all (\x x < 10)
+func prop-no-a  : String -> Bool   = not (any (\c c == 'a'))
+func prop-float : Float -> Bool    = \x x < 2.5
+func prop-holds : List Int -> Bool = \xs length (reverse xs) == length xs
+func prop-panic : Int -> Int -> Bool = \x \y if (x > 3) (panic "big") true
+`)
+	tests := []struct {
+		name string
+		want *regexp.Regexp
+	}{
+		{"prop-short", regexp.MustCompile(`on: \[0, 0, 0\]$`)},
+		{"prop-small", regexp.MustCompile(`on: \[10\]$`)},
+		{"prop-no-a", regexp.MustCompile(`on: "a"$`)},
+		{"prop-float", regexp.MustCompile(`on: [0-9]+\.[0-9]+$`)},
+		{"prop-holds", regexp.MustCompile(`^$`)},
+		{"prop-panic", regexp.MustCompile(`on: 4 0$`)},
+	}
+	for _, test := range tests {
+		params, ok := propParams(env.TypeInfo(test.name, 0))
+		if !ok {
+			t.Fatalf("%s: not a property", test.name)
+		}
+		message, err := checkProperty(env, compileGlobal(t, env, test.name), params, 1, 100)
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		if !test.want.MatchString(message) {
+			t.Errorf("%s: got %q, want %v", test.name, message, test.want)
+		}
+	}
+}
@@ -1,132 +1,289 @@
 package funky
 
 import (
+	"errors"
 	"flag"
 	"fmt"
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	goruntime "runtime"
+	"strings"
 	"time"
 
 	"github.com/faiface/funky/compile"
 	"github.com/faiface/funky/expr"
 	"github.com/faiface/funky/parse"
+	"github.com/faiface/funky/parse/parseinfo"
 	"github.com/faiface/funky/runtime"
-
-	cxr "github.com/faiface/crux/runtime"
+	"github.com/faiface/funky/runtime/native"
+	"github.com/faiface/funky/types"
 )
 
+// Run compiles the program from the command line and returns its main value. The program
+// gets all the files in $FUNKY, including the ones in its subdirectories.
 func Run(main string) (value *runtime.Value, cleanup func()) {
+	value, _, _, cleanup = RunTyped(allStdlibs, main)
+	return value, cleanup
+}
+
+// RunStdlib is like Run, but the program only gets the files directly in $FUNKY and the files
+// in the stdlib directory in $FUNKY, which holds the library of the interpreter, such as cmd
+// for funkycmd.
+func RunStdlib(stdlib, main string) (value *runtime.Value, cleanup func()) {
+	value, _, _, cleanup = RunTyped(stdlib, main)
+	return value, cleanup
+}
+
+// RunTyped is like RunStdlib, but it also returns the type of main and all the union types of
+// the program, so that interpreters can check that they understand the program.
+func RunTyped(stdlib, main string) (value *runtime.Value, typ types.Type, unions map[string]*types.Union, cleanup func()) {
 	noStdlib := flag.Bool("nostd", false, "do not automatically include files from $FUNKY")
 	stats := flag.Bool("stats", false, "print stats after running program")
 	typesSandbox := flag.Bool("types", false, "start types sandbox instead of running the program")
 	listDefinitions := flag.Bool("list", false, "list all the definitions instead of running the program")
 	dump := flag.String("dump", "", "specify a file to dump the compiled code into")
+	search := flag.String("search", "", "search for functions by type instead of running the program")
+	explain := flag.String("explain", "", "print how variables in the specified function resolve to overloads")
+	output := flag.String("o", "", "write the compiled program into a file instead of running it")
+	build := flag.String("build", "", "write the program as Go source of a standalone funkycmd binary instead of running it")
+	noInline := flag.Bool("noinline", false, "do not inline small functions")
+	noBeta := flag.Bool("nobeta", false, "do not beta reduce")
+	noFold := flag.Bool("nofold", false, "do not fold constant operator applications")
+	noKnownCase := flag.Bool("noknowncase", false, "do not eliminate switches on known constructors")
+	noStrictness := flag.Bool("nostrictness", false, "do not evaluate arguments strictly based on strictness analysis")
 	flag.Parse()
 
 	compilationStart := time.Now()
 
-	var definitions []parse.Definition
+	var prog *program
 
-	// files from the standard library
-	if funkyPath, ok := os.LookupEnv("FUNKY"); !*noStdlib && ok {
-		err := filepath.Walk(funkyPath, func(path string, info os.FileInfo, err error) error {
-			if err != nil {
-				return err
-			}
-			if info.IsDir() {
-				return nil
-			}
-			b, err := ioutil.ReadFile(path)
-			handleErrs(err)
-			tokens, err := parse.Tokenize(path, string(b))
-			handleErrs(err)
-			defs, err := parse.Definitions(tokens)
-			handleErrs(err)
-			definitions = append(definitions, defs...)
-			return nil
-		})
+	if args := sourceArgs(); len(args) == 1 && filepath.Ext(args[0]) == ".fnc" {
+		// precompiled program, no need for the standard library or type checking
+		var err error
+		if *build != "" {
+			handleErrs(errors.New("-build needs the source files, not a compiled program"))
+		}
+		prog, err = loadProgram(args[0])
 		handleErrs(err)
-	}
+	} else {
+		definitions := readDefinitions(*noStdlib, stdlib, args)
 
-	// files included on the command line
-	for _, path := range flag.Args() {
-		b, err := ioutil.ReadFile(path)
-		handleErrs(err)
-		tokens, err := parse.Tokenize(path, string(b))
-		handleErrs(err)
-		defs, err := parse.Definitions(tokens)
-		handleErrs(err)
-		definitions = append(definitions, defs...)
-	}
+		if *listDefinitions {
+			for _, def := range definitions {
+				switch value := def.Value.(type) {
+				case expr.Expr:
+					fmt.Printf("%s\n", def.Name)
+					fmt.Printf("  %s\n", value.TypeInfo())
+					fmt.Printf("  %s\n", value.SourceInfo())
+				}
+			}
+			os.Exit(0)
+		}
+
+		env := &compile.Env{Options: compile.Options{
+			NoInline:    *noInline,
+			NoBeta:      *noBeta,
+			NoFold:      *noFold,
+			NoKnownCase: *noKnownCase,
 
-	if *listDefinitions {
+			NoStrictness: *noStrictness,
+		}}
 		for _, def := range definitions {
-			switch value := def.Value.(type) {
-			case expr.Expr:
-				fmt.Printf("%s\n", def.Name)
-				fmt.Printf("  %s\n", value.TypeInfo())
-				fmt.Printf("  %s\n", value.SourceInfo())
-			}
+			err := env.Add(def)
+			handleErrs(err)
 		}
-		os.Exit(0)
-	}
 
-	env := new(compile.Env)
-	for _, def := range definitions {
-		err := env.Add(def)
-		handleErrs(err)
-	}
+		errs := env.Validate()
+		handleErrs(errs...)
 
-	errs := env.Validate()
-	handleErrs(errs...)
+		if *typesSandbox {
+			runTypesSandbox(env)
+			os.Exit(0)
+		}
 
-	if *typesSandbox {
-		runTypesSandbox(env)
-		os.Exit(0)
-	}
+		if *search != "" {
+			handleErrs(runSearch(os.Stdout, env, *search))
+			os.Exit(0)
+		}
 
-	errs = env.TypeInfer()
-	handleErrs(errs...)
-	globalIndices, globalValues, codeIndices, codes := env.Compile(main)
+		errs = env.TypeInfer()
+		handleErrs(errs...)
 
-	if len(globalIndices[main]) == 0 {
+		if *explain != "" {
+			handleErrs(explainResolutions(os.Stdout, env, *explain))
+			os.Exit(0)
+		}
+
+		if *build != "" {
+			handleErrs(buildProgram(*build, env, main))
+			os.Exit(0)
+		}
+
+		prog, errs = compileProgram(env, main)
+		handleErrs(errs...)
+	}
+
+	if len(prog.globalIndices[main]) == 0 {
 		handleErrs(fmt.Errorf("no %s function", main))
 	}
-	if len(globalIndices[main]) > 1 {
+	if len(prog.globalIndices[main]) > 1 {
 		handleErrs(fmt.Errorf("multiple %s functions", main))
 	}
 
+	if *output != "" {
+		handleErrs(saveProgram(*output, prog))
+		os.Exit(0)
+	}
+
 	if *dump != "" {
 		df, err := os.Create(*dump)
 		handleErrs(err)
-		for name := range globalIndices {
-			for i := range globalIndices[name] {
-				fmt.Fprintf(df, "# %v\n", env.SourceInfo(name, i))
-				fmt.Fprintf(df, "# %v\n", env.TypeInfo(name, i))
+		for name := range prog.globalIndices {
+			for i := range prog.globalIndices[name] {
+				if prog.globalIndices[name][i] < 0 {
+					continue // pruned
+				}
+				fmt.Fprintf(df, "# %v\n", prog.sourceInfos[name][i])
+				fmt.Fprintf(df, "# %v\n", prog.typeInfos[name][i])
 				fmt.Fprintf(df, "FUNC %s/%d\n", name, i)
-				dumpCodes(df, globalIndices, &codes[codeIndices[name][i]])
+				dumpCodes(df, prog.globalIndices, &prog.codes[prog.codeIndices[name][i]])
 				fmt.Fprintln(df)
 			}
 		}
 		handleErrs(df.Close())
 	}
 
-	program := &runtime.Value{Globals: globalValues, Value: globalValues[globalIndices[main][0]]}
+	instance := runtime.NewProgram(prog.globalValues)
+	program := instance.Global(prog.globalIndices[main][0])
+
+	tokens, err := parse.Tokenize("", prog.typeInfos[main][0])
+	handleErrs(err)
+	typ, err = parse.Type(tokens)
+	handleErrs(err)
 
 	runningStart := time.Now()
 
-	return program, func() {
+	return program, typ, prog.unions, func() {
+		// cleanup is deferred, so it can recover from failures of the program
+		if r := recover(); r != nil {
+			err, ok := r.(*runtime.Error)
+			if !ok {
+				panic(r)
+			}
+			sourceInfo := func(name string, overload int) *parseinfo.Source { return prog.sourceInfos[name][overload] }
+			fmt.Fprintf(os.Stderr, "panic: %s%s\n", err.Msg, formatStack(err.Stack, sourceInfo))
+			if frame, ok := prog.sources.Origin(err.Value); ok && len(err.Stack) == 0 {
+				fmt.Fprintf(os.Stderr, "  evaluating %v\n", frame)
+			}
+			defer os.Exit(1)
+		}
 		if *stats {
 			fmt.Fprintf(os.Stderr, "\n")
 			fmt.Fprintf(os.Stderr, "STATS\n")
-			fmt.Fprintf(os.Stderr, "reductions:       %d\n", cxr.Reductions)
+			if prog.compileStats != nil {
+				fmt.Fprintf(os.Stderr, "definitions:      %d\n", prog.compileStats.Definitions)
+				fmt.Fprintf(os.Stderr, "pruned:           %d\n", prog.compileStats.Pruned)
+				fmt.Fprintf(os.Stderr, "inlined:          %d\n", prog.compileStats.Inlined)
+				fmt.Fprintf(os.Stderr, "beta reduced:     %d\n", prog.compileStats.BetaReduced)
+				fmt.Fprintf(os.Stderr, "known cases:      %d\n", prog.compileStats.KnownCases)
+				fmt.Fprintf(os.Stderr, "folded:           %d\n", prog.compileStats.Folded)
+				fmt.Fprintf(os.Stderr, "strictified:      %d\n", prog.compileStats.Strictified)
+			}
+			var mem goruntime.MemStats
+			goruntime.ReadMemStats(&mem)
+			fmt.Fprintf(os.Stderr, "reductions:       %d\n", instance.Stats().Reductions)
+			fmt.Fprintf(os.Stderr, "allocated memory: %d MB\n", mem.TotalAlloc>>20)
+			fmt.Fprintf(os.Stderr, "heap size:        %d MB\n", mem.HeapSys>>20)
 			fmt.Fprintf(os.Stderr, "compilation time: %v\n", runningStart.Sub(compilationStart))
 			fmt.Fprintf(os.Stderr, "running time:     %v\n", time.Since(runningStart))
 		}
 	}
 }
 
+// formatStack returns the lines of the globals a native program panicked in, see runtime.Error
+func formatStack(stack []native.Frame, sourceInfo func(name string, overload int) *parseinfo.Source) string {
+	var b strings.Builder
+	for _, frame := range stack {
+		fmt.Fprintf(&b, "\n  in %v", compile.Frame{
+			Name:       frame.Name,
+			Overload:   frame.Overload,
+			SourceInfo: sourceInfo(frame.Name, frame.Overload),
+		})
+	}
+	return b.String()
+}
+
+// sourceArgs returns the command-line arguments before --, which are the source files
+func sourceArgs() []string {
+	args := flag.Args()
+	for i, arg := range args {
+		if arg == "--" {
+			return args[:i]
+		}
+	}
+	return args
+}
+
+// ProgramArgs returns the command-line arguments after --, which are passed to the program
+// instead of being source files. It must be called after Run.
+func ProgramArgs() []string {
+	args := flag.Args()
+	for i, arg := range args {
+		if arg == "--" {
+			return args[i+1:]
+		}
+	}
+	return nil
+}
+
+// allStdlibs makes readDefinitions read all the directories in $FUNKY
+const allStdlibs = "*"
+
+// readDefinitions reads the files directly in $FUNKY, the files in the stdlib directory in
+// $FUNKY, and the files in paths. The other directories in $FUNKY belong to other interpreters.
+func readDefinitions(noStdlib bool, stdlib string, paths []string) []parse.Definition {
+	var definitions []parse.Definition
+
+	// files from the standard library
+	if funkyPath, ok := os.LookupEnv("FUNKY"); !noStdlib && ok {
+		stdlibPath := filepath.Join(funkyPath, stdlib)
+		err := filepath.Walk(funkyPath, func(path string, info os.FileInfo, err error) error {
+			if err != nil {
+				return err
+			}
+			if info.IsDir() {
+				if path == funkyPath || stdlib == allStdlibs || (stdlib != "" && path == stdlibPath) {
+					return nil
+				}
+				return filepath.SkipDir
+			}
+			b, err := ioutil.ReadFile(path)
+			handleErrs(err)
+			tokens, err := parse.Tokenize(path, string(b))
+			handleErrs(err)
+			defs, err := parse.Definitions(tokens)
+			handleErrs(err)
+			definitions = append(definitions, defs...)
+			return nil
+		})
+		handleErrs(err)
+	}
+
+	// files included on the command line
+	for _, path := range paths {
+		b, err := ioutil.ReadFile(path)
+		handleErrs(err)
+		tokens, err := parse.Tokenize(path, string(b))
+		handleErrs(err)
+		defs, err := parse.Definitions(tokens)
+		handleErrs(err)
+		definitions = append(definitions, defs...)
+	}
+
+	return definitions
+}
+
 func handleErrs(errs ...error) {
 	bad := false
 	for _, err := range errs {
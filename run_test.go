@@ -0,0 +1,47 @@
+package funky
+
+import (
+	"os"
+	"testing"
+)
+
+func TestReadDefinitions(t *testing.T) {
+	funkyPath, ok := os.LookupEnv("FUNKY")
+	os.Setenv("FUNKY", "stdlib")
+	defer func() {
+		if ok {
+			os.Setenv("FUNKY", funkyPath)
+		} else {
+			os.Unsetenv("FUNKY")
+		}
+	}()
+
+	tests := []struct {
+		stdlib            string
+		union, otherUnion string
+	}{
+		{"cmd", "IO", "OS"},
+		{"os", "OS", "IO"},
+	}
+	for _, test := range tests {
+		names := make(map[string]bool)
+		for _, def := range readDefinitions(false, test.stdlib, nil) {
+			names[def.Name] = true
+		}
+		if !names[test.union] || !names["Vector"] {
+			t.Errorf("%s: missing %s or Vector", test.stdlib, test.union)
+		}
+		if names[test.otherUnion] {
+			t.Errorf("%s: includes %s of another interpreter", test.stdlib, test.otherUnion)
+		}
+	}
+
+	// Run reads all of them
+	names := make(map[string]bool)
+	for _, def := range readDefinitions(false, allStdlibs, nil) {
+		names[def.Name] = true
+	}
+	if !names["IO"] || !names["OS"] || !names["Vector"] {
+		t.Error("all stdlibs: missing IO, OS or Vector")
+	}
+}
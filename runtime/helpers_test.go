@@ -0,0 +1,74 @@
+package runtime_test
+
+import (
+	"testing"
+
+	"github.com/faiface/funky/compile"
+	"github.com/faiface/funky/parse"
+	"github.com/faiface/funky/runtime"
+)
+
+// prelude defines the types the builtin functions need, the standard library isn't loaded
+const prelude = `
+union Bool = true | false
+union List a = empty | a :: List a
+alias String = List Char
+`
+
+func testEnv(t *testing.T, src string) *compile.Env {
+	t.Helper()
+	tokens, err := parse.Tokenize("test.fn", src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	definitions, err := parse.Definitions(tokens)
+	if err != nil {
+		t.Fatal(err)
+	}
+	env := new(compile.Env)
+	for _, def := range definitions {
+		if err := env.Add(def); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, err := range append(env.Validate(), env.TypeInfer()...) {
+		t.Fatal(err)
+	}
+	return env
+}
+
+// programs returns functions making new programs of the globals, one evaluated by crux and one
+// native, together with the indices of the globals
+func programs(t *testing.T, env *compile.Env, names ...string) map[string]func() (*runtime.Program, map[string][]int32) {
+	t.Helper()
+	globalIndices, globalValues, _, _, _, errs := env.Compile(names...)
+	for _, err := range errs {
+		t.Fatal(err)
+	}
+	exprs, errs := env.Exprs(names...)
+	for _, err := range errs {
+		t.Fatal(err)
+	}
+	return map[string]func() (*runtime.Program, map[string][]int32){
+		"crux": func() (*runtime.Program, map[string][]int32) {
+			return runtime.NewProgram(globalValues), globalIndices
+		},
+		"native": func() (*runtime.Program, map[string][]int32) {
+			return runtime.NewNativeProgram(exprs, env.OperatorArity)
+		},
+	}
+}
+
+// backends returns functions getting the globals by name from a new program of each backend
+func backends(t *testing.T, env *compile.Env, names ...string) map[string]func(name string) *runtime.Value {
+	t.Helper()
+	globals := make(map[string]func(name string) *runtime.Value)
+	for backend, newProgram := range programs(t, env, names...) {
+		newProgram := newProgram
+		globals[backend] = func(name string) *runtime.Value {
+			program, globalIndices := newProgram()
+			return program.Global(globalIndices[name][0])
+		}
+	}
+	return globals
+}
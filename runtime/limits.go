@@ -0,0 +1,80 @@
+package runtime
+
+import (
+	"context"
+	goruntime "runtime"
+	"runtime/metrics"
+	"sync"
+)
+
+// Limits restrict the evaluation of an untrusted program. The reductions are counted by the
+// program evaluating the values, see Program, and shared by all the values with the same limits.
+// Once the limits are exceeded, all the evaluations within them fail right away.
+//
+// Only native programs can be limited, see NewNativeProgram. They check the limits while they
+// reduce, every native.CheckInterval reductions, and the evaluation exceeding them stops and
+// leaves the program as it was before. Crux can't interrupt a reduction, so evaluating a value
+// of any other program within limits fails with *LimitError right away.
+//
+// Go doesn't tell how much memory a goroutine holds, so MaxHeap is approximate: it limits the
+// live heap of the whole process, including the other evaluations and the Go code around them.
+type Limits struct {
+	Context       context.Context // cancels the evaluation, nil for no cancellation
+	MaxReductions int             // number of reductions of all the evaluations, 0 for no limit
+	MaxHeap       uint64          // bytes of the live heap of the whole process, 0 for no limit
+
+	mu         sync.Mutex
+	reductions int
+	err        *LimitError
+}
+
+// LimitError is the error of an evaluation that exceeded its limits. Err is the error of the
+// context if it was cancelled.
+type LimitError struct {
+	Msg string
+	Err error
+}
+
+func (err *LimitError) Error() string { return err.Msg }
+func (err *LimitError) Unwrap() error { return err.Err }
+
+// check adds the reductions done since the last check and returns the error if the limits are
+// exceeded
+func (l *Limits) check(reductions int) *LimitError {
+	if l == nil {
+		return nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.reductions += reductions
+	if l.err != nil {
+		return l.err
+	}
+	if l.Context != nil {
+		select {
+		case <-l.Context.Done():
+			l.err = &LimitError{Msg: "evaluation cancelled: " + l.Context.Err().Error(), Err: l.Context.Err()}
+			return l.err
+		default:
+		}
+	}
+	if l.MaxReductions > 0 && l.reductions > l.MaxReductions {
+		l.err = &LimitError{Msg: "reduction limit exceeded"}
+		return l.err
+	}
+	if l.MaxHeap > 0 && heap() > l.MaxHeap {
+		// the heap counts the garbage too until it's collected
+		goruntime.GC()
+		if heap() > l.MaxHeap {
+			l.err = &LimitError{Msg: "heap limit exceeded"}
+		}
+	}
+	return l.err
+}
+
+// heap returns the bytes of the heap objects, without stopping the world like ReadMemStats
+func heap() uint64 {
+	sample := []metrics.Sample{{Name: "/memory/classes/heap/objects:bytes"}}
+	metrics.Read(sample)
+	return sample[0].Value.Uint64()
+}
@@ -0,0 +1,189 @@
+package runtime_test
+
+import (
+	"context"
+	"errors"
+	goruntime "runtime"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/faiface/funky/compile"
+	"github.com/faiface/funky/runtime"
+)
+
+const limitsSrc = prelude + `
+func loop : Int -> Int = \n loop (inc n)
+
+func sum : Int -> Int -> Int =
+    \acc \n
+    switch n == 0
+    case true  acc
+    case false sum (acc + n) (dec n)
+
+func looping : Int = loop 0
+func summed  : Int = sum 0 1000
+`
+
+func nativeGlobals(t *testing.T, env *compile.Env) (*runtime.Program, func(name string) *runtime.Value) {
+	t.Helper()
+	exprs, errs := env.Exprs("looping", "summed")
+	for _, err := range errs {
+		t.Fatal(err)
+	}
+	program, globalIndices := runtime.NewNativeProgram(exprs, env.OperatorArity)
+	return program, func(name string) *runtime.Value { return program.Global(globalIndices[name][0]) }
+}
+
+func TestNativeLimits(t *testing.T) {
+	env := testEnv(t, limitsSrc)
+	goroutines := goruntime.NumGoroutine()
+	program, global := nativeGlobals(t, env)
+
+	for i := 0; i < 2; i++ {
+		limits := &runtime.Limits{MaxReductions: 10000}
+		_, err := global("looping").WithLimits(limits).TryInt()
+		var limitErr *runtime.LimitError
+		if !errors.As(err, &limitErr) || limitErr.Msg != "reduction limit exceeded" {
+			t.Fatalf("run %d: got %v, want the reduction limit", i, err)
+		}
+		// the limits stay exceeded
+		if _, err := global("summed").WithLimits(limits).TryInt(); err != limitErr {
+			t.Errorf("run %d: got %v after exceeding the limits", i, err)
+		}
+	}
+	if reductions := program.Stats().Reductions; reductions < 20000 || reductions > 30000 {
+		t.Errorf("got %d reductions, want two evaluations stopped after about 10000", reductions)
+	}
+
+	// the program is still usable
+	sum, err := global("summed").WithLimits(&runtime.Limits{MaxReductions: 100000}).TryInt()
+	if err != nil || sum.Int64() != 500500 {
+		t.Errorf("got %v, %v, want 500500", sum, err)
+	}
+
+	// the evaluations stop instead of running in the background
+	if n := goruntime.NumGoroutine(); n > goroutines {
+		t.Errorf("got %d goroutines, want %d", n, goroutines)
+	}
+}
+
+func TestNativeCancel(t *testing.T) {
+	_, global := nativeGlobals(t, testEnv(t, limitsSrc))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err := global("looping").WithLimits(&runtime.Limits{Context: ctx}).TryInt()
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("got %v, want the deadline", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("stopped after %v", elapsed)
+	}
+}
+
+func TestCruxLimits(t *testing.T) {
+	env := testEnv(t, limitsSrc)
+	globalIndices, globalValues, _, _, _, errs := env.Compile("looping", "summed")
+	for _, err := range errs {
+		t.Fatal(err)
+	}
+	program := runtime.NewProgram(globalValues)
+	global := func(name string) *runtime.Value { return program.Global(globalIndices[name][0]) }
+
+	// crux can't be interrupted, so it doesn't even start
+	limits := []*runtime.Limits{
+		{MaxReductions: 10},
+		{MaxReductions: 1000000000},
+		{Context: context.Background()},
+	}
+	for _, limits := range limits {
+		for _, name := range []string{"looping", "summed"} {
+			_, err := global(name).WithLimits(limits).TryInt()
+			var limitErr *runtime.LimitError
+			if !errors.As(err, &limitErr) {
+				t.Errorf("%s: got %v, want a limit error", name, err)
+			}
+		}
+	}
+	if reductions := program.Stats().Reductions; reductions != 0 {
+		t.Errorf("got %d reductions, want none", reductions)
+	}
+
+	// the program is still usable without limits
+	if sum, err := global("summed").TryInt(); err != nil || sum.Int64() != 500500 {
+		t.Errorf("got %v, %v, want 500500", sum, err)
+	}
+}
+
+const heapSrc = prelude + `
+func grow : List Int -> Int -> Int = \list \n grow (n :: list) (inc n)
+func growing : Int = grow empty 0
+`
+
+func TestNativeHeap(t *testing.T) {
+	env := testEnv(t, heapSrc)
+	exprs, errs := env.Exprs("growing")
+	for _, err := range errs {
+		t.Fatal(err)
+	}
+	program, globalIndices := runtime.NewNativeProgram(exprs, env.OperatorArity)
+	growing := program.Global(globalIndices["growing"][0])
+
+	var mem goruntime.MemStats
+	goruntime.ReadMemStats(&mem)
+	before := mem.HeapAlloc
+	_, err := growing.WithLimits(&runtime.Limits{MaxHeap: before + 32<<20}).TryInt()
+	var limitErr *runtime.LimitError
+	if !errors.As(err, &limitErr) || limitErr.Msg != "heap limit exceeded" {
+		t.Fatalf("got %v, want the heap limit", err)
+	}
+
+	// the list is garbage now
+	goruntime.GC()
+	goruntime.ReadMemStats(&mem)
+	if mem.HeapAlloc > before+16<<20 {
+		t.Errorf("got %d bytes of heap after the evaluation stopped, %d before", mem.HeapAlloc, before)
+	}
+}
+
+// TestParallelLimits is meant for go test -race, the programs count their reductions separately.
+func TestParallelLimits(t *testing.T) {
+	env := testEnv(t, limitsSrc)
+	const n = 8
+	var (
+		wg         sync.WaitGroup
+		reductions [n]int
+		errs       [n]error
+	)
+	for i := 0; i < n; i++ {
+		program, global := nativeGlobals(t, env)
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if _, err := global("looping").WithLimits(&runtime.Limits{MaxReductions: 5000}).TryInt(); err == nil {
+				errs[i] = errors.New("looping finished")
+				return
+			}
+			sum, err := global("summed").WithLimits(&runtime.Limits{MaxReductions: 100000}).TryInt()
+			if err != nil {
+				errs[i] = err
+				return
+			}
+			if sum.Int64() != 500500 {
+				errs[i] = errors.New("wrong sum " + sum.String())
+			}
+			reductions[i] = program.Stats().Reductions
+		}(i)
+	}
+	wg.Wait()
+	for i := range errs {
+		if errs[i] != nil {
+			t.Errorf("program %d: %v", i, errs[i])
+		}
+		if reductions[i] != reductions[0] {
+			t.Errorf("program %d: got %d reductions, program 0 got %d", i, reductions[i], reductions[0])
+		}
+	}
+}
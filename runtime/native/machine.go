@@ -0,0 +1,351 @@
+package native
+
+import (
+	goruntime "runtime"
+	"sync"
+	"sync/atomic"
+
+	"github.com/faiface/crux"
+	cxr "github.com/faiface/crux/runtime"
+)
+
+// CheckInterval is the number of reductions between the checks of a Machine.
+const CheckInterval = 1000
+
+// maxSparks is the number of sparks waiting for a worker, see Machine, more of them get dropped
+const maxSparks = 1024
+
+// Machine counts the reductions of the functions made by it, instead of the package's counter,
+// and lets their evaluation get stopped. A machine and its values must only be used by one
+// goroutine at a time, but separate machines evaluate in parallel.
+//
+// The builtin par x y of the compiled programs sparks x, see Compile: a worker goroutine
+// evaluates x to the weak head normal form in parallel, up to GOMAXPROCS workers. When the
+// evaluation needs a value a worker is evaluating, it waits for it. Sparks are speculative, a
+// worker that fails or would have to wait gives the spark up and whoever needs the value
+// evaluates it again. The sparks belong to the evaluation that made them, Stop stops them.
+type Machine struct {
+	// Reductions include the ones of the workers once they're stopped by Stop.
+	Reductions int
+
+	// Check gets called with the number of reductions since the previous call, every
+	// CheckInterval reductions of each goroutine evaluating the machine's values, so it must
+	// be safe for concurrent use. A non-nil error stops the evaluation and Reduce panics with
+	// it, a worker gives up its spark instead. The thunks being evaluated stay unevaluated,
+	// so the values can be evaluated again.
+	Check func(reductions int) error
+
+	sinceCheck int
+
+	mu        sync.Mutex
+	sparks    []cxr.Value
+	workers   int
+	running   sync.WaitGroup
+	stopping  int32 // read atomically, changed under mu
+	sparked   int   // reductions of the stopped workers
+	unchecked int   // reductions of the stopped workers not passed to Check
+}
+
+// Frame is an overload of a global of a compiled program, see Panic.
+type Frame struct {
+	Name     string
+	Overload int
+}
+
+// Func is like the package's Func, but the function's reductions count in the machine.
+func (m *Machine) Func(arity int, fn func(args []cxr.Value) cxr.Value) cxr.Value {
+	return m.function(arity, func(_ *worker, args []cxr.Value) cxr.Value { return fn(args) })
+}
+
+// function makes a function evaluating its arguments on the worker it's applied on
+func (m *Machine) function(arity int, fn func(w *worker, args []cxr.Value) cxr.Value) cxr.Value {
+	return &function{arity: arity, fn: fn, machine: m}
+}
+
+func (m *Machine) reduce(w *worker, reductions int) {
+	switch {
+	case m == nil:
+		Reductions += reductions
+	case w != nil:
+		w.reduce(reductions)
+	default:
+		m.Reductions += reductions
+		m.sinceCheck += reductions
+		if m.Check != nil && m.sinceCheck >= CheckInterval {
+			err := m.Check(m.sinceCheck)
+			m.sinceCheck = 0
+			if err != nil {
+				panic(err)
+			}
+		}
+	}
+}
+
+func (w *worker) reduce(reductions int) {
+	m := w.machine
+	if atomic.LoadInt32(&m.stopping) != 0 {
+		panic(giveUp{})
+	}
+	w.reductions += reductions
+	w.sinceCheck += reductions
+	if m.Check != nil && w.sinceCheck >= CheckInterval {
+		err := m.Check(w.sinceCheck)
+		w.sinceCheck = 0
+		if err != nil {
+			panic(giveUp{})
+		}
+	}
+}
+
+// spark lets a worker evaluate the value, unless it's evaluated already or there are too many
+// sparks waiting
+func (m *Machine) spark(v cxr.Value) {
+	t, ok := v.(*thunk)
+	if m == nil || !ok || atomic.LoadUint32(&t.state) != unevaluated {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.stopping != 0 || len(m.sparks) >= maxSparks {
+		return
+	}
+	m.sparks = append(m.sparks, t)
+	if m.workers < goruntime.GOMAXPROCS(0) {
+		m.workers++
+		m.running.Add(1)
+		go m.work()
+	}
+}
+
+// work evaluates the sparks, the oldest first, until there are none
+func (m *Machine) work() {
+	defer m.running.Done()
+	w := &worker{machine: m}
+	for {
+		m.mu.Lock()
+		if m.stopping != 0 || len(m.sparks) == 0 {
+			m.workers--
+			m.sparked += w.reductions
+			m.unchecked += w.sinceCheck
+			m.mu.Unlock()
+			return
+		}
+		v := m.sparks[0]
+		m.sparks[0] = nil
+		m.sparks = m.sparks[1:]
+		m.mu.Unlock()
+		w.evaluate(v)
+	}
+}
+
+func (w *worker) evaluate(v cxr.Value) {
+	defer func() {
+		// given up or failed, whoever needs the value evaluates it again, and fails too
+		recover()
+	}()
+	w.force(v)
+}
+
+// Stop stops the workers evaluating the sparks and waits for them. Their reductions get added
+// to Reductions and the ones not checked yet, including the goroutine's, get passed to Check.
+// The goroutine that evaluated the machine's values calls it when it's done with them.
+func (m *Machine) Stop() {
+	m.mu.Lock()
+	atomic.StoreInt32(&m.stopping, 1)
+	m.sparks = nil
+	m.mu.Unlock()
+	m.running.Wait()
+
+	m.mu.Lock()
+	atomic.StoreInt32(&m.stopping, 0)
+	m.Reductions += m.sparked
+	unchecked := m.sinceCheck + m.unchecked
+	m.sparked, m.unchecked, m.sinceCheck = 0, 0, 0
+	m.mu.Unlock()
+	if m.Check != nil && unchecked > 0 {
+		// the evaluation is over, only the following ones fail
+		m.Check(unchecked)
+	}
+}
+
+// Compile makes the native values of the compiled expressions, indexed the same way, see
+// compile.Env.Exprs. They get evaluated the same way as the Go code generated by funky -build.
+// Abstractions become functions taking their parameters and everything that doesn't depend
+// on them gets made once. The evaluation of the values panics with *Panic, which tells in
+// which globals it failed.
+//
+// The builtin par, which crux evaluates as \x \y y, sparks x before returning y.
+func (m *Machine) Compile(exprs map[string][]crux.Expr, operatorArity func(code int32) int) map[string][]cxr.Value {
+	c := &compiler{machine: m, operatorArity: operatorArity, globals: make(map[string][]cxr.Value)}
+
+	// the globals exist before they're compiled, so that they can refer to each other
+	for name := range exprs {
+		c.globals[name] = make([]cxr.Value, len(exprs[name]))
+		for i, e := range exprs[name] {
+			switch e := e.(type) {
+			case nil:
+			case *crux.Abst:
+				c.globals[name][i] = &function{arity: len(e.Bound), machine: m}
+			default:
+				c.globals[name][i] = &thunk{}
+			}
+		}
+	}
+	for name := range exprs {
+		for i, e := range exprs[name] {
+			c.frame = &Frame{Name: name, Overload: i}
+			switch global := c.globals[name][i].(type) {
+			case *function:
+				global.fn = c.function(e.(*crux.Abst))
+				if isPar(name, e) {
+					global.fn = func(_ *worker, args []cxr.Value) cxr.Value {
+						m.spark(args[0])
+						return args[1]
+					}
+				}
+				global.frame = c.frame
+			case *thunk:
+				// evaluated at most once, just like crux's globals
+				body := c.tail(nil, e)
+				global.fn = func(w *worker) cxr.Value { return body(w, nil) }
+				global.frame = c.frame
+			}
+		}
+	}
+	return c.globals
+}
+
+// isPar reports whether the global is the builtin par : a -> b -> b, see compile.Env
+func isPar(name string, e crux.Expr) bool {
+	abst, ok := e.(*crux.Abst)
+	if name != "par" || !ok || len(abst.Bound) != 2 || abst.Bound[0] == abst.Bound[1] {
+		return false
+	}
+	v, ok := abst.Body.(*crux.Var)
+	return ok && v.Index < 0 && v.Name == abst.Bound[1]
+}
+
+// code returns the value of an expression from the arguments of the function it's in,
+// evaluated on the worker
+type code func(w *worker, args []cxr.Value) cxr.Value
+
+type compiler struct {
+	machine       *Machine
+	operatorArity func(code int32) int
+	globals       map[string][]cxr.Value
+	frame         *Frame // of the global being compiled, its functions and thunks belong to it
+}
+
+// function compiles the body of the closed abstraction
+func (c *compiler) function(abst *crux.Abst) func(w *worker, args []cxr.Value) cxr.Value {
+	// the last one of parameters with the same name wins
+	locals := make(map[string]int)
+	for i, bound := range abst.Bound {
+		locals[bound] = i
+	}
+	return c.tail(locals, abst.Body)
+}
+
+// tail compiles the expression to its value, which may be unevaluated
+func (c *compiler) tail(locals map[string]int, e crux.Expr) code {
+	switch e := e.(type) {
+	case *crux.Appl:
+		return c.appl(locals, e)
+
+	case *crux.Strict:
+		return c.tail(locals, e.Expr)
+
+	case *crux.Switch:
+		expr := c.lazy(locals, e.Expr)
+		cases := make([]code, len(e.Cases))
+		for i, cas := range e.Cases {
+			cases[i] = c.lazy(locals, cas)
+		}
+		return func(w *worker, args []cxr.Value) cxr.Value {
+			str := w.structOf(expr(w, args))
+			return ApplyFields(cases[str.Index](w, args), str)
+		}
+
+	default:
+		return c.lazy(locals, e)
+	}
+}
+
+// appl compiles the application, which evaluates its strict arguments
+func (c *compiler) appl(locals map[string]int, e *crux.Appl) code {
+	rator := c.lazy(locals, e.Rator)
+	rands := make([]code, len(e.Rands))
+	for i, rand := range e.Rands {
+		if strict, ok := rand.(*crux.Strict); ok {
+			lazy := c.lazy(locals, strict.Expr)
+			rands[i] = func(w *worker, args []cxr.Value) cxr.Value { return w.force(lazy(w, args)) }
+			continue
+		}
+		rands[i] = c.lazy(locals, rand)
+	}
+	return func(w *worker, args []cxr.Value) cxr.Value {
+		values := make([]cxr.Value, len(rands))
+		for i := range rands {
+			values[i] = rands[i](w, args)
+		}
+		return Apply(rator(w, args), values...)
+	}
+}
+
+// lazy compiles the expression to its unevaluated value
+func (c *compiler) lazy(locals map[string]int, e crux.Expr) code {
+	switch e := e.(type) {
+	case *crux.Char:
+		return constant(&cxr.Char{Value: e.Value})
+	case *crux.Int:
+		var i cxr.Int
+		i.Value.Set(&e.Value)
+		return constant(&i)
+	case *crux.Float:
+		return constant(&cxr.Float{Value: e.Value})
+	case *crux.Operator:
+		return constant(c.machine.Operator(e.Code, c.operatorArity(e.Code)))
+	case *crux.Make:
+		return constant(Make(e.Index))
+	case *crux.Field:
+		return constant(c.machine.Field(e.Index))
+
+	case *crux.Var:
+		if e.Index >= 0 {
+			return constant(c.globals[e.Name][e.Index])
+		}
+		i := locals[e.Name]
+		return func(_ *worker, args []cxr.Value) cxr.Value { return args[i] }
+
+	case *crux.Abst:
+		return constant(&function{arity: len(e.Bound), fn: c.function(e), machine: c.machine, frame: c.frame})
+
+	case *crux.Appl:
+		appl, frame := c.appl(locals, e), c.frame
+		for _, rand := range e.Rands {
+			if _, ok := rand.(*crux.Strict); ok {
+				// the strict arguments get evaluated when the application does
+				return func(_ *worker, args []cxr.Value) cxr.Value {
+					return &thunk{fn: func(w *worker) cxr.Value { return appl(w, args) }, frame: frame}
+				}
+			}
+		}
+		return appl
+
+	case *crux.Strict:
+		return c.lazy(locals, e.Expr)
+
+	case *crux.Switch:
+		tail, frame := c.tail(locals, e), c.frame
+		return func(_ *worker, args []cxr.Value) cxr.Value {
+			return &thunk{fn: func(w *worker) cxr.Value { return tail(w, args) }, frame: frame}
+		}
+
+	default:
+		panic("unreachable")
+	}
+}
+
+func constant(value cxr.Value) code {
+	return func(*worker, []cxr.Value) cxr.Value { return value }
+}
@@ -0,0 +1,389 @@
+// Package native evaluates the programs generated by funky -build, whose functions are Go
+// functions instead of crux codes. The data are the same as crux's: chars, ints, floats and
+// structs, so the native values work with the runtime package and its drivers. Operators are
+// evaluated by crux, so they behave exactly the same.
+package native
+
+import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+
+	"github.com/faiface/crux"
+	cxr "github.com/faiface/crux/runtime"
+)
+
+// Reductions counts the applications of the functions that don't belong to a Machine, just
+// like crux's counter of reductions.
+var Reductions = 0
+
+// cruxMu serializes the reductions by crux, which counts them in a variable shared by the whole
+// process
+var cruxMu sync.Mutex
+
+// states of a thunk
+const (
+	unevaluated uint32 = iota
+	evaluating
+	evaluated
+)
+
+// thunk is either a Go function producing the value, or an application of a function. The
+// workers of a Machine force the thunks together with the goroutine that called Force, so
+// the thunk gets claimed by one of them and the others wait for it, see worker.wait.
+type thunk struct {
+	state uint32 // read atomically, changed under mu
+
+	mu     sync.Mutex
+	owner  *worker       // evaluating the thunk, nil for the goroutine that called Force
+	done   chan struct{} // closed when the owner is a worker and stops evaluating the thunk
+	fn     func(w *worker) cxr.Value
+	f      cxr.Value
+	args   []cxr.Value
+	result cxr.Value
+	frame  *Frame // of the global fn belongs to, nil if unknown
+}
+
+type function struct {
+	arity   int
+	fn      func(w *worker, args []cxr.Value) cxr.Value
+	args    []cxr.Value // partially applied
+	machine *Machine    // counts the reductions, nil for the package's counter
+	frame   *Frame      // of the global the function belongs to, nil if unknown
+}
+
+// worker evaluates the sparks of a Machine in its own goroutine. The functions evaluating
+// the values get the worker they run on, which is nil for the goroutine that called Force.
+type worker struct {
+	machine    *Machine
+	reductions int // not added to the machine's yet
+	sinceCheck int
+}
+
+// giveUp is the panic of a worker that stops evaluating its spark, see worker.wait
+type giveUp struct{}
+
+// maxStack is the number of the innermost frames a Panic keeps
+const maxStack = 64
+
+// Panic is the panic of an evaluation interrupted in the globals of a compiled program, see
+// Machine.Compile. Value is the original panic.
+//
+// Stack contains the globals whose evaluation was in progress, innermost first. Each of them
+// was evaluating a value needed by the next one, for example an argument of an operator. Tail
+// calls replace their callers, so only the last global of a chain of tail calls is there.
+type Panic struct {
+	Value interface{}
+	Stack []Frame
+}
+
+func (p *Panic) String() string { return fmt.Sprint(p.Value) }
+
+// unwind adds the frame to the stack of the panic
+func unwind(r interface{}, frame Frame) *Panic {
+	p, ok := r.(*Panic)
+	if !ok {
+		p = &Panic{Value: r}
+	}
+	if len(p.Stack) < maxStack {
+		p.Stack = append(p.Stack, frame)
+	}
+	return p
+}
+
+// Lazy returns a value computed by the function when needed. The function may return another
+// unevaluated value, so that tail calls don't grow the stack.
+func Lazy(fn func() cxr.Value) cxr.Value {
+	return &thunk{fn: func(*worker) cxr.Value { return fn() }}
+}
+
+// Func returns a function of the arity. The arguments are unevaluated and the function may
+// return an unevaluated value.
+func Func(arity int, fn func(args []cxr.Value) cxr.Value) cxr.Value {
+	return (*Machine)(nil).Func(arity, fn)
+}
+
+// Apply returns the unevaluated application of the function to the arguments.
+func Apply(f cxr.Value, args ...cxr.Value) cxr.Value {
+	return &thunk{f: f, args: args}
+}
+
+// Make returns the constructor of the alternative, which gains fields when applied.
+func Make(alternative int32) cxr.Value {
+	return &cxr.Struct{Index: alternative}
+}
+
+// Field returns the function getting the field of a record.
+func Field(i int32) cxr.Value {
+	return (*Machine)(nil).Field(i)
+}
+
+func (m *Machine) Field(i int32) cxr.Value {
+	return m.function(1, func(w *worker, args []cxr.Value) cxr.Value {
+		str := w.structOf(args[0])
+		return str.Values[len(str.Values)-int(i)-1]
+	})
+}
+
+// Is reports whether the value is a native function or an unevaluated native value.
+func Is(v cxr.Value) bool {
+	switch v.(type) {
+	case *thunk, *function:
+		return true
+	}
+	return false
+}
+
+// Reduce applies the value to the arguments and evaluates the result to the weak head
+// normal form.
+func Reduce(v cxr.Value, args ...cxr.Value) cxr.Value {
+	if len(args) > 0 {
+		v = Apply(v, args...)
+	}
+	return Force(v)
+}
+
+// Force evaluates the value to the weak head normal form. A panic in the globals of a compiled
+// program is re-panicked as *Panic.
+func Force(v cxr.Value) cxr.Value {
+	return (*worker)(nil).force(v)
+}
+
+func (w *worker) force(v cxr.Value) cxr.Value {
+	var (
+		pending []*thunk
+		frame   *Frame // of the global being evaluated
+	)
+	defer func() {
+		if r := recover(); r != nil {
+			// the thunks can be evaluated again, for example after a recovered panic
+			for _, t := range pending {
+				t.release()
+			}
+			if frame != nil {
+				panic(unwind(r, *frame))
+			}
+			panic(r)
+		}
+	}()
+
+loop:
+	for {
+		switch x := v.(type) {
+		case *thunk:
+			if atomic.LoadUint32(&x.state) == evaluated {
+				v = x.result
+				continue
+			}
+			x.mu.Lock()
+			switch x.state {
+			case evaluated:
+				x.mu.Unlock()
+				continue
+			case evaluating:
+				owner, done := x.owner, x.done
+				x.mu.Unlock()
+				w.wait(owner, done)
+				continue
+			}
+			atomic.StoreUint32(&x.state, evaluating)
+			x.owner = w
+			if w != nil {
+				x.done = make(chan struct{})
+			}
+			fn, f, args := x.fn, x.f, x.args
+			x.mu.Unlock()
+
+			pending = append(pending, x)
+			if fn != nil {
+				if x.frame != nil {
+					frame = x.frame
+				}
+				v = fn(w)
+			} else {
+				var called *Frame
+				v, called = w.apply(f, args)
+				if called != nil {
+					frame = called
+				}
+			}
+		case *cxr.Thunk:
+			// a part of a result of an operator
+			v, _ = ReduceCrux(nil, x)
+		default:
+			break loop
+		}
+	}
+
+	for _, t := range pending {
+		t.finish(v)
+	}
+	return v
+}
+
+// wait waits until the owner of a thunk stops evaluating it. Only the goroutine that called
+// Force waits, the workers give up their sparks instead. This way, the workers never wait for
+// each other or for the evaluation that sparked them, so nobody waits forever.
+func (w *worker) wait(owner *worker, done <-chan struct{}) {
+	switch {
+	case w != nil:
+		panic(giveUp{})
+	case owner == nil:
+		panic("infinite loop: value depends on itself")
+	}
+	<-done
+}
+
+func (t *thunk) finish(result cxr.Value) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.result = result
+	t.fn, t.f, t.args = nil, nil, nil
+	t.wake()
+	atomic.StoreUint32(&t.state, evaluated)
+}
+
+func (t *thunk) release() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.wake()
+	atomic.StoreUint32(&t.state, unevaluated)
+}
+
+// wake wakes up the goroutine waiting for the owner, it must be called under the lock
+func (t *thunk) wake() {
+	if t.done != nil {
+		close(t.done)
+	}
+	t.owner, t.done = nil, nil
+}
+
+// Struct evaluates the value, which must be a record or a union.
+func Struct(v cxr.Value) *cxr.Struct {
+	return (*worker)(nil).structOf(v)
+}
+
+func (w *worker) structOf(v cxr.Value) *cxr.Struct {
+	v = w.force(v)
+	str, ok := v.(*cxr.Struct)
+	if !ok {
+		panic(fmt.Sprintf("expected record or union, got %T", v))
+	}
+	return str
+}
+
+// ApplyFields returns the unevaluated application of a switch case to the fields of the
+// alternative.
+func ApplyFields(cas cxr.Value, str *cxr.Struct) cxr.Value {
+	if len(str.Values) == 0 {
+		return cas
+	}
+	fields := make([]cxr.Value, len(str.Values))
+	for i := range fields {
+		fields[i] = str.Values[len(str.Values)-i-1]
+	}
+	return Apply(cas, fields...)
+}
+
+// apply does one step of an application, the result may be unevaluated. It returns the frame
+// of the function it called, if it has one.
+func (w *worker) apply(f cxr.Value, args []cxr.Value) (cxr.Value, *Frame) {
+	switch f := w.force(f).(type) {
+	case *function:
+		all := args
+		if len(f.args) > 0 {
+			all = make([]cxr.Value, 0, len(f.args)+len(args))
+			all = append(append(all, f.args...), args...)
+		}
+		if len(all) < f.arity {
+			return &function{arity: f.arity, fn: f.fn, args: all, machine: f.machine, frame: f.frame}, nil
+		}
+		f.machine.reduce(w, 1)
+		result := f.fn(w, all[:f.arity:f.arity])
+		if len(all) > f.arity {
+			return &thunk{f: result, args: all[f.arity:]}, f.frame
+		}
+		return result, f.frame
+
+	case *cxr.Struct:
+		// a constructor gains fields, which are stored in reverse
+		values := make([]cxr.Value, 0, len(args)+len(f.Values))
+		for i := len(args) - 1; i >= 0; i-- {
+			values = append(values, args[i])
+		}
+		values = append(values, f.Values...)
+		return &cxr.Struct{Index: f.Index, Values: values}, nil
+
+	default:
+		panic(fmt.Sprintf("cannot apply %T", f))
+	}
+}
+
+// Operator returns the function evaluating the operator of the arity with crux.
+func Operator(code int32, arity int) cxr.Value {
+	return (*Machine)(nil).Operator(code, arity)
+}
+
+func (m *Machine) Operator(code int32, arity int) cxr.Value {
+	globalIndices, globals, _, _ := crux.Compile(map[string][]crux.Expr{
+		"op": {&crux.Operator{Code: code}},
+	})
+	op := globals[globalIndices["op"][0]]
+
+	return m.function(arity, func(w *worker, args []cxr.Value) cxr.Value {
+		if code == cxr.OpDump {
+			// crux would evaluate the returned value, which it can't do with native values
+			_, reductions := ReduceCrux(globals, op, w.forceString(args[0]), &cxr.Struct{})
+			m.reduce(w, reductions)
+			return args[1]
+		}
+		forced := make([]cxr.Value, len(args))
+		for i := range args {
+			if stringArg(code, i) {
+				forced[i] = w.forceString(args[i])
+			} else {
+				forced[i] = w.force(args[i])
+			}
+		}
+		result, reductions := ReduceCrux(globals, op, forced...)
+		m.reduce(w, reductions)
+		return result
+	})
+}
+
+// ReduceCrux evaluates the value applied to the arguments with crux, see cxr.Reduce, and returns
+// the number of reductions it took. Only one goroutine reduces with crux at a time.
+func ReduceCrux(globals []cxr.Value, value cxr.Value, args ...cxr.Value) (result cxr.Value, reductions int) {
+	cruxMu.Lock()
+	defer cruxMu.Unlock()
+	start := cxr.Reductions
+	result = cxr.Reduce(globals, value, args...)
+	return result, cxr.Reductions - start
+}
+
+// stringArg reports whether the argument of the operator is a String, which crux expects
+// to be fully evaluated
+func stringArg(code int32, i int) bool {
+	switch code {
+	case cxr.OpStringInt, cxr.OpStringFloat, cxr.OpError:
+		return i == 0
+	}
+	return false
+}
+
+func (w *worker) forceString(v cxr.Value) cxr.Value {
+	var chars []cxr.Value
+	for {
+		str := w.structOf(v)
+		if str.Index == 0 {
+			break
+		}
+		chars = append(chars, w.force(str.Values[1]))
+		v = str.Values[0]
+	}
+	list := &cxr.Struct{Index: 0}
+	for i := len(chars) - 1; i >= 0; i-- {
+		list = &cxr.Struct{Index: 1, Values: []cxr.Value{list, chars[i]}}
+	}
+	return list
+}
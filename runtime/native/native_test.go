@@ -0,0 +1,146 @@
+package native
+
+import (
+	"errors"
+	"math/big"
+	"testing"
+
+	cxr "github.com/faiface/crux/runtime"
+)
+
+func char(v cxr.Value) rune { return Force(v).(*cxr.Char).Value }
+
+func TestSharing(t *testing.T) {
+	evaluations := 0
+	x := Lazy(func() cxr.Value {
+		evaluations++
+		return &cxr.Char{Value: 'x'}
+	})
+	if char(x) != 'x' || char(x) != 'x' || evaluations != 1 {
+		t.Errorf("evaluated %d times, want once", evaluations)
+	}
+}
+
+func TestPartialApplication(t *testing.T) {
+	second := Func(2, func(args []cxr.Value) cxr.Value { return args[1] })
+	a, b, c := &cxr.Char{Value: 'a'}, &cxr.Char{Value: 'b'}, &cxr.Char{Value: 'c'}
+
+	partial := Reduce(second, a)
+	if got := char(Apply(partial, b)); got != 'b' {
+		t.Errorf("second a b: got %q", got)
+	}
+	if got := char(Apply(partial, c)); got != 'c' {
+		t.Errorf("second a c: got %q", got)
+	}
+	// the result applied to the extra argument
+	if got := char(Apply(second, a, second, b, c)); got != 'c' {
+		t.Errorf("second a second b c: got %q", got)
+	}
+}
+
+func TestConstructor(t *testing.T) {
+	a, b := &cxr.Char{Value: 'a'}, &cxr.Char{Value: 'b'}
+	pair := Apply(Make(1), a, b)
+	if got := char(Apply(Field(0), pair)); got != 'a' {
+		t.Errorf("field 0: got %q", got)
+	}
+	if got := char(Apply(Field(1), pair)); got != 'b' {
+		t.Errorf("field 1: got %q", got)
+	}
+	str := Struct(pair)
+	if str.Index != 1 {
+		t.Errorf("alternative: got %d", str.Index)
+	}
+	cas := Func(2, func(args []cxr.Value) cxr.Value { return args[0] })
+	if got := char(ApplyFields(cas, str)); got != 'a' {
+		t.Errorf("case applied to fields: got %q", got)
+	}
+}
+
+func TestTailCalls(t *testing.T) {
+	// counts down without growing the stack
+	var countdown cxr.Value
+	countdown = Func(1, func(args []cxr.Value) cxr.Value {
+		n := Force(args[0]).(*cxr.Int)
+		if n.Value.Sign() == 0 {
+			return &cxr.Char{Value: 'd'}
+		}
+		var m cxr.Int
+		m.Value.Sub(&n.Value, big.NewInt(1))
+		return Apply(countdown, &m)
+	})
+	var n cxr.Int
+	n.Value.SetInt64(1000000)
+	if got := char(Apply(countdown, &n)); got != 'd' {
+		t.Errorf("got %q", got)
+	}
+}
+
+func TestInfiniteLoop(t *testing.T) {
+	var x cxr.Value
+	x = Lazy(func() cxr.Value { return Force(x) })
+	defer func() {
+		if r := recover(); r == nil {
+			t.Error("no panic")
+		}
+	}()
+	Force(x)
+}
+
+func TestPanicLeavesThunkUnevaluated(t *testing.T) {
+	fail := true
+	x := Lazy(func() cxr.Value {
+		if fail {
+			panic("failed")
+		}
+		return &cxr.Char{Value: 'x'}
+	})
+	func() {
+		defer func() { recover() }()
+		Force(x)
+	}()
+	fail = false
+	if got := char(x); got != 'x' {
+		t.Errorf("got %q", got)
+	}
+}
+
+func TestMachine(t *testing.T) {
+	m := new(Machine)
+	var loop cxr.Value
+	loop = m.Func(1, func(args []cxr.Value) cxr.Value { return Apply(loop, args[0]) })
+	x := Lazy(func() cxr.Value { return Apply(loop, &cxr.Char{Value: 'x'}) })
+
+	stop := errors.New("stop")
+	m.Check = func(int) error {
+		if m.Reductions >= 5*CheckInterval {
+			return stop
+		}
+		return nil
+	}
+	before := Reductions
+	func() {
+		defer func() {
+			if r := recover(); r != stop {
+				t.Errorf("got panic %v, want the error of Check", r)
+			}
+		}()
+		Force(x)
+	}()
+	if m.Reductions != 5*CheckInterval {
+		t.Errorf("got %d reductions, want %d", m.Reductions, 5*CheckInterval)
+	}
+	if Reductions != before {
+		t.Errorf("counted %d reductions in the package's counter", Reductions-before)
+	}
+
+	// the stopped thunk can be evaluated again
+	m.Check = func(int) error { return stop }
+	func() {
+		defer func() { recover() }()
+		Force(x)
+	}()
+	if m.Reductions != 6*CheckInterval {
+		t.Errorf("got %d reductions after the second run, want %d", m.Reductions, 6*CheckInterval)
+	}
+}
@@ -0,0 +1,157 @@
+package runtime
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/faiface/crux"
+	cxr "github.com/faiface/crux/runtime"
+	"github.com/faiface/funky/runtime/native"
+)
+
+// Program is a running instance of a compiled program. Reduction updates the thunks of the
+// program's globals in place, so the values obtained from a program reduce under its lock. They
+// can be used from multiple goroutines, but only one of them evaluates at a time.
+//
+// Native programs, made by NewNativeProgram, count their reductions themselves, evaluate in
+// parallel with other programs and are the only ones that can be evaluated within Limits. Crux
+// counts its reductions in a variable shared by the whole process, so only one program reduces
+// with crux at a time.
+//
+// Every program has its own copy of the globals, so the evaluations of one don't affect others
+// made from the same globals. Only the globals of programs generated by funky -build are shared,
+// they're variables of the generated code.
+//
+// Values made by the Mk functions don't belong to any program. Values of different programs
+// must not be mixed, for example by applying a function of one program to a value of another.
+type Program struct {
+	globals []cxr.Value
+	machine *native.Machine // nil for programs evaluated by crux or generated by funky -build
+
+	mu         sync.Mutex
+	reductions int
+}
+
+type Stats struct {
+	Reductions int
+}
+
+// NewProgram makes a program evaluating the globals made by crux.Compile or loaded from a file.
+// The globals themselves never get evaluated, the program evaluates their copies.
+func NewProgram(globals []cxr.Value) *Program {
+	copied := make([]cxr.Value, len(globals))
+	for i, global := range globals {
+		if thunk, ok := global.(*cxr.Thunk); ok {
+			c := *thunk
+			global = &c
+		}
+		copied[i] = global
+	}
+	return &Program{globals: copied}
+}
+
+// NewNativeProgram makes a program evaluating the compiled expressions natively, see
+// compile.Env.Exprs. Its evaluations check their Limits as they reduce. It returns the indices
+// of the globals by the overloads of the expressions, -1 for the ones without an expression.
+func NewNativeProgram(exprs map[string][]crux.Expr, operatorArity func(code int32) int) (p *Program, globalIndices map[string][]int32) {
+	machine := new(native.Machine)
+	values := machine.Compile(exprs, operatorArity)
+
+	var names []string
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	p = &Program{machine: machine}
+	globalIndices = make(map[string][]int32)
+	for _, name := range names {
+		for _, value := range values[name] {
+			if value == nil {
+				globalIndices[name] = append(globalIndices[name], -1)
+				continue
+			}
+			globalIndices[name] = append(globalIndices[name], int32(len(p.globals)))
+			p.globals = append(p.globals, value)
+		}
+	}
+	return p, globalIndices
+}
+
+// Global returns the value of the global with the index, usually the main function
+func (p *Program) Global(index int32) *Value {
+	return &Value{Globals: p.globals, Value: p.globals[index], program: p}
+}
+
+func (p *Program) Stats() Stats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return Stats{Reductions: p.reductions}
+}
+
+func (p *Program) lock() {
+	if p != nil {
+		p.mu.Lock()
+	}
+}
+
+func (p *Program) unlock() {
+	if p != nil {
+		p.mu.Unlock()
+	}
+}
+
+// reduce evaluates the value applied to the arguments within the limits and counts the
+// reductions, it must be called under the lock
+func (p *Program) reduce(globals []cxr.Value, limits *Limits, value cxr.Value, args ...cxr.Value) cxr.Value {
+	if p == nil {
+		// values made by the Mk functions, nothing to count
+		result, _ := reduce(globals, value, args...)
+		return result
+	}
+	if p.machine == nil {
+		if limits != nil {
+			// crux would only stop after the whole reduction, if ever
+			panic(&LimitError{Msg: "limits need a native program, crux can't be interrupted"})
+		}
+		result, reductions := reduce(globals, value, args...)
+		p.reductions += reductions
+		return result
+	}
+	if err := limits.check(0); err != nil {
+		panic(err)
+	}
+	return p.reduceNative(limits, value, args...)
+}
+
+// reduceNative checks the limits while the machine reduces and records the stack of a panic.
+// The sparks of the evaluation get stopped when it's done.
+func (p *Program) reduceNative(limits *Limits, value cxr.Value, args ...cxr.Value) cxr.Value {
+	m := p.machine
+	start := m.Reductions
+	if limits != nil {
+		m.Check = func(reductions int) error {
+			if err := limits.check(reductions); err != nil {
+				return err
+			}
+			return nil
+		}
+	}
+	defer func() {
+		m.Stop()
+		m.Check = nil
+		p.reductions += m.Reductions - start
+		if r := recover(); r != nil {
+			var stack []native.Frame
+			if panicked, ok := r.(*native.Panic); ok {
+				r, stack = panicked.Value, panicked.Stack
+			}
+			if err, ok := r.(*LimitError); ok {
+				panic(err)
+			}
+			panic(&Error{Msg: fmt.Sprint(r), Value: value, Stack: stack})
+		}
+	}()
+	return native.Reduce(value, args...)
+}
@@ -0,0 +1,199 @@
+package runtime_test
+
+import (
+	"errors"
+	"fmt"
+	goruntime "runtime"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/faiface/crux"
+	"github.com/faiface/funky/compile"
+	"github.com/faiface/funky/runtime"
+)
+
+const programSrc = prelude + `
+func sum : Int -> Int -> Int =
+    \acc \n
+    switch n == 0
+    case true  acc
+    case false sum (acc + n) (dec n)
+
+func summed : Int = sum 0 1000
+func broken : Int = panic "broken"
+`
+
+func TestProgramsDontShareGlobals(t *testing.T) {
+	for backend, global := range backends(t, testEnv(t, programSrc), "summed", "broken") {
+		for i := 0; i < 2; i++ {
+			if _, err := global("broken").TryInt(); err == nil || !strings.HasSuffix(err.Error(), "broken") {
+				t.Errorf("%s: program %d: got %v, want broken", backend, i, err)
+			}
+		}
+	}
+}
+
+// TestParallelPrograms is meant for go test -race. The programs made from the same globals
+// evaluate them separately and count only their own reductions.
+func TestParallelPrograms(t *testing.T) {
+	for backend, newProgram := range programs(t, testEnv(t, programSrc), "summed") {
+		const n = 8
+		var (
+			wg         sync.WaitGroup
+			reductions [n]int
+			errs       [n]error
+		)
+		for i := 0; i < n; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				program, globalIndices := newProgram()
+				sum, err := program.Global(globalIndices["summed"][0]).TryInt()
+				if err != nil {
+					errs[i] = err
+					return
+				}
+				if sum.Int64() != 500500 {
+					errs[i] = errors.New("wrong sum " + sum.String())
+				}
+				reductions[i] = program.Stats().Reductions
+			}(i)
+		}
+		wg.Wait()
+		for i := range errs {
+			if errs[i] != nil {
+				t.Errorf("%s: program %d: %v", backend, i, errs[i])
+			}
+			if reductions[i] == 0 || reductions[i] != reductions[0] {
+				t.Errorf("%s: program %d: got %d reductions, program 0 got %d", backend, i, reductions[i], reductions[0])
+			}
+		}
+	}
+}
+
+func TestConcurrentValues(t *testing.T) {
+	for backend, global := range backends(t, testEnv(t, programSrc), "summed") {
+		summed := global("summed")
+		var wg sync.WaitGroup
+		for i := 0; i < 8; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if sum, err := summed.TryInt(); err != nil || sum.Int64() != 500500 {
+					t.Errorf("%s: got %v, %v", backend, sum, err)
+				}
+			}()
+		}
+		wg.Wait()
+	}
+}
+
+const stackSrc = prelude + `
+func check : Int -> Int =
+    \n
+    switch n == 0
+    case true  panic "zero"
+    case false n
+
+func plus-one : Int -> Int = \n 1 + check n
+func failing  : Int = plus-one 0 * 2
+`
+
+func TestStack(t *testing.T) {
+	env := testEnv(t, stackSrc)
+	env.Options.NoInline = true
+	want := map[string]string{
+		// each of them evaluates an argument of an operator in the next one
+		"native": "check/0 plus-one/0 failing/0",
+		// crux doesn't expose its stack
+		"crux": "",
+	}
+	for backend, global := range backends(t, env, "failing") {
+		for i := 0; i < 2; i++ {
+			_, err := global("failing").TryInt()
+			var runtimeErr *runtime.Error
+			if !errors.As(err, &runtimeErr) || !strings.HasSuffix(runtimeErr.Msg, "zero") {
+				t.Fatalf("%s: got %v, want the panic", backend, err)
+			}
+			var frames []string
+			for _, frame := range runtimeErr.Stack {
+				frames = append(frames, fmt.Sprintf("%s/%d", frame.Name, frame.Overload))
+			}
+			if got := strings.Join(frames, " "); got != want[backend] {
+				t.Errorf("%s: evaluation %d: got stack %q, want %q", backend, i, got, want[backend])
+			}
+		}
+	}
+}
+
+const parSrc = prelude + `
+func fib : Int -> Int =
+    \n
+    switch n < 2
+    case true  n
+    case false fib (n - 1) + fib (n - 2)
+
+func fibs : Int -> Int =
+    \n
+    switch n == 0
+    case true  0
+    case false (\x par x (x + fibs (dec n))) (fib 15)
+
+func loop : Int -> Int = \n loop (inc n)
+
+func shared        : Int = (\x par x (x + x)) (fib 18)
+func many          : Int = fibs 50
+func spark-panics  : Int = par (panic "spark") 1
+func spark-loops   : Int = par (loop 0) 2
+func needed-panics : Int = (\x par x (x + 1)) (panic "needed")
+func both-loop     : Int = par (loop 0) (loop 0)
+`
+
+func TestPar(t *testing.T) {
+	env := testEnv(t, parSrc)
+	names := []string{"shared", "many", "spark-panics", "spark-loops", "needed-panics", "both-loop"}
+	tests := []struct {
+		name string
+		want int64
+		err  string
+	}{
+		{"shared", 5168, ""},
+		{"many", 30500, ""},
+		{"spark-panics", 1, ""},
+		{"spark-loops", 2, ""},
+		{"needed-panics", 0, "needed"},
+	}
+	goroutines := goruntime.NumGoroutine()
+	for backend, global := range backends(t, env, names...) {
+		for _, test := range tests {
+			got, err := global(test.name).TryInt()
+			switch {
+			case test.err != "" && (err == nil || !strings.HasSuffix(err.Error(), test.err)):
+				t.Errorf("%s: %s: got %v, want %s", backend, test.name, err, test.err)
+			case test.err == "" && (err != nil || got.Int64() != test.want):
+				t.Errorf("%s: %s: got %v, %v, want %d", backend, test.name, got, err, test.want)
+			}
+		}
+	}
+
+	// the sparks stop with the evaluation, also when it exceeds its limits
+	program, globalIndices := runtime.NewNativeProgram(mustExprs(t, env, names...), env.OperatorArity)
+	_, err := program.Global(globalIndices["both-loop"][0]).WithLimits(&runtime.Limits{MaxReductions: 100000}).TryInt()
+	var limitErr *runtime.LimitError
+	if !errors.As(err, &limitErr) {
+		t.Errorf("got %v, want the reduction limit", err)
+	}
+	if n := goruntime.NumGoroutine(); n > goroutines {
+		t.Errorf("got %d goroutines, want %d", n, goroutines)
+	}
+}
+
+func mustExprs(t *testing.T, env *compile.Env, names ...string) map[string][]crux.Expr {
+	t.Helper()
+	exprs, errs := env.Exprs(names...)
+	for _, err := range errs {
+		t.Fatal(err)
+	}
+	return exprs
+}
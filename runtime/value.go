@@ -1,41 +1,228 @@
 package runtime
 
 import (
+	"fmt"
 	"math/big"
 	"strings"
 
 	cxr "github.com/faiface/crux/runtime"
+	"github.com/faiface/funky/runtime/native"
 )
 
+// Value is a value of a running program. The values obtained from a Program are safe to use from
+// multiple goroutines, see Program. The other ones must only be used by one goroutine at a time,
+// because evaluation updates them and the globals in place.
 type Value struct {
 	Globals []cxr.Value
 	Value   cxr.Value
+
+	// inherited by fields and results of applications
+	program *Program
+	limits  *Limits
+}
+
+// Error is a failure during the evaluation of a program, like a call to panic or accessing
+// a value as something it isn't. Value is the value that was being evaluated.
+//
+// Stack contains the globals that were being evaluated, innermost first, see native.Panic.
+// Only native programs record it, crux doesn't expose its reduction stack.
+type Error struct {
+	Msg   string
+	Value cxr.Value
+	Stack []native.Frame
+}
+
+func (err *Error) Error() string { return err.Msg }
+
+// catch turns any panic into *Error, it must be deferred before evaluating the value
+func catch(value cxr.Value) {
+	if r := recover(); r != nil {
+		switch err := r.(type) {
+		case *Error, *LimitError:
+			panic(err)
+		}
+		panic(&Error{Msg: fmt.Sprint(r), Value: value})
+	}
+}
+
+// whnf reduces the value to the weak head normal form and returns it
+func (v *Value) whnf() cxr.Value {
+	v.program.lock()
+	defer v.program.unlock()
+	value := v.Value
+	defer catch(value)
+	v.Value = v.program.reduce(v.Globals, v.limits, value)
+	return v.Value
+}
+
+// reduce evaluates the value applied to the arguments with crux, or natively if the value comes
+// from a program generated by funky -build, and returns the number of the reductions
+func reduce(globals []cxr.Value, value cxr.Value, args ...cxr.Value) (result cxr.Value, reductions int) {
+	if native.Is(value) {
+		start := native.Reductions
+		result = native.Reduce(value, args...)
+		return result, native.Reductions - start
+	}
+	return native.ReduceCrux(globals, value, args...)
+}
+
+// WithLimits returns the same value, which gets evaluated within the limits, together with all
+// the values obtained from it. Only the values of native programs can be limited, see Limits.
+func (v *Value) WithLimits(limits *Limits) *Value {
+	v.program.lock()
+	defer v.program.unlock()
+	return &Value{Globals: v.Globals, Value: v.Value, program: v.program, limits: limits}
+}
+
+// Reduce evaluates the value to the weak head normal form. It returns *Error if the program
+// panics and *LimitError if the evaluation exceeds its limits.
+func (v *Value) Reduce() (err error) {
+	defer recoverErr(&err)
+	v.whnf()
+	return nil
+}
+
+// recoverErr turns a panic with *Error or *LimitError into the error, it must be deferred
+func recoverErr(err *error) {
+	if r := recover(); r != nil {
+		switch r := r.(type) {
+		case *Error:
+			*err = r
+		case *LimitError:
+			*err = r
+		default:
+			panic(r)
+		}
+	}
+}
+
+// mismatch is the error of accessing a value as something it isn't, most likely because the Go
+// code doesn't match the types in the Funky code
+func mismatch(value cxr.Value, expected string) *Error {
+	var actual string
+	switch value := value.(type) {
+	case *cxr.Char:
+		actual = "Char"
+	case *cxr.Int:
+		actual = "Int"
+	case *cxr.Float:
+		actual = "Float"
+	case *cxr.Struct:
+		actual = fmt.Sprintf("record or union (alternative %d, %d fields)", value.Index, len(value.Values))
+	default:
+		actual = "function"
+	}
+	return &Error{Msg: fmt.Sprintf("expected %s, got %s", expected, actual), Value: value}
+}
+
+func (v *Value) Char() rune {
+	value := v.whnf()
+	c, ok := value.(*cxr.Char)
+	if !ok {
+		panic(mismatch(value, "Char"))
+	}
+	return c.Value
 }
 
-func (v *Value) reduce() { v.Value = cxr.Reduce(v.Globals, v.Value) }
+func (v *Value) Int() *big.Int {
+	value := v.whnf()
+	i, ok := value.(*cxr.Int)
+	if !ok {
+		panic(mismatch(value, "Int"))
+	}
+	return &i.Value
+}
 
-func (v *Value) Char() rune     { v.reduce(); return v.Value.(*cxr.Char).Value }
-func (v *Value) Int() *big.Int  { v.reduce(); return &v.Value.(*cxr.Int).Value }
-func (v *Value) Float() float64 { v.reduce(); return v.Value.(*cxr.Float).Value }
+func (v *Value) Float() float64 {
+	value := v.whnf()
+	f, ok := value.(*cxr.Float)
+	if !ok {
+		panic(mismatch(value, "Float"))
+	}
+	return f.Value
+}
 
 func (v *Value) Alternative() int {
-	v.reduce()
-	return int(v.Value.(*cxr.Struct).Index)
+	value := v.whnf()
+	str, ok := value.(*cxr.Struct)
+	if !ok {
+		panic(mismatch(value, "record or union"))
+	}
+	return int(str.Index)
 }
 
 func (v *Value) Field(i int) *Value {
-	v.reduce()
-	str := v.Value.(*cxr.Struct)
+	value := v.whnf()
+	str, ok := value.(*cxr.Struct)
+	if !ok {
+		panic(mismatch(value, "record or union"))
+	}
+	if i < 0 || i >= len(str.Values) {
+		panic(&Error{Msg: fmt.Sprintf("expected field %d, got %d fields", i, len(str.Values)), Value: value})
+	}
 	index := len(str.Values) - i - 1
-	return &Value{v.Globals, str.Values[index]}
+	return &Value{Globals: v.Globals, Value: str.Values[index], program: v.program, limits: v.limits}
 }
 
 func (v *Value) Apply(args ...*Value) *Value {
+	v.program.lock()
+	defer v.program.unlock()
+	defer catch(v.Value)
 	values := make([]cxr.Value, len(args))
 	for i := range values {
 		values[i] = args[i].Value
 	}
-	return &Value{v.Globals, cxr.Reduce(v.Globals, v.Value, values...)}
+	result := v.program.reduce(v.Globals, v.limits, v.Value, values...)
+	return &Value{Globals: v.Globals, Value: result, program: v.program, limits: v.limits}
+}
+
+// The Try variants of the accessors return the failures of the evaluation as errors instead
+// of panicking: *Error if the program panics or the value isn't what it's accessed as, and
+// *LimitError if the evaluation exceeds its limits.
+
+func (v *Value) TryChar() (c rune, err error) {
+	defer recoverErr(&err)
+	return v.Char(), nil
+}
+
+func (v *Value) TryInt() (i *big.Int, err error) {
+	defer recoverErr(&err)
+	return v.Int(), nil
+}
+
+func (v *Value) TryFloat() (f float64, err error) {
+	defer recoverErr(&err)
+	return v.Float(), nil
+}
+
+func (v *Value) TryAlternative() (alt int, err error) {
+	defer recoverErr(&err)
+	return v.Alternative(), nil
+}
+
+func (v *Value) TryField(i int) (field *Value, err error) {
+	defer recoverErr(&err)
+	return v.Field(i), nil
+}
+
+func (v *Value) TryApply(args ...*Value) (result *Value, err error) {
+	defer recoverErr(&err)
+	return v.Apply(args...), nil
+}
+
+func (v *Value) TryBool() (b bool, err error) {
+	defer recoverErr(&err)
+	return v.Bool(), nil
+}
+
+func (v *Value) TryList() (list []*Value, err error) {
+	defer recoverErr(&err)
+	return v.List(), nil
+}
+
+func (v *Value) TryString() (s string, err error) {
+	defer recoverErr(&err)
+	return v.String(), nil
 }
 
 func (v *Value) Bool() bool {
@@ -61,23 +248,23 @@ func (v *Value) String() string {
 }
 
 func MkChar(c rune) *Value {
-	return &Value{nil, &cxr.Char{Value: c}}
+	return &Value{Value: &cxr.Char{Value: c}}
 }
 
 func MkInt(i *big.Int) *Value {
 	var v cxr.Int
 	v.Value.Set(i)
-	return &Value{nil, &v}
+	return &Value{Value: &v}
 }
 
 func MkInt64(i int64) *Value {
 	var v cxr.Int
 	v.Value.SetInt64(i)
-	return &Value{nil, &v}
+	return &Value{Value: &v}
 }
 
 func MkFloat(f float64) *Value {
-	return &Value{nil, &cxr.Float{Value: f}}
+	return &Value{Value: &cxr.Float{Value: f}}
 }
 
 func MkRecord(fields ...*Value) *Value {
@@ -85,7 +272,7 @@ func MkRecord(fields ...*Value) *Value {
 	for i := len(fields) - 1; i >= 0; i-- {
 		str.Values = append(str.Values, fields[i].Value)
 	}
-	return &Value{nil, str}
+	return &Value{Value: str}
 }
 
 func MkUnion(alternative int, fields ...*Value) *Value {
@@ -93,7 +280,7 @@ func MkUnion(alternative int, fields ...*Value) *Value {
 	for i := len(fields) - 1; i >= 0; i-- {
 		str.Values = append(str.Values, fields[i].Value)
 	}
-	return &Value{nil, str}
+	return &Value{Value: str}
 }
 
 func MkBool(b bool) *Value {
@@ -101,7 +288,7 @@ func MkBool(b bool) *Value {
 	if !b {
 		index = 1
 	}
-	return &Value{nil, &cxr.Struct{Index: index}}
+	return &Value{Value: &cxr.Struct{Index: index}}
 }
 
 func MkList(elems ...*Value) *Value {
@@ -109,7 +296,7 @@ func MkList(elems ...*Value) *Value {
 	for i := len(elems) - 1; i >= 0; i-- {
 		list = &cxr.Struct{Index: 1, Values: []cxr.Value{list, elems[i].Value}}
 	}
-	return &Value{nil, list}
+	return &Value{Value: list}
 }
 
 func MkString(s string) *Value {
@@ -118,5 +305,90 @@ func MkString(s string) *Value {
 	for i := len(runes) - 1; i >= 0; i-- {
 		str = &cxr.Struct{Index: 1, Values: []cxr.Value{str, &cxr.Char{Value: runes[i]}}}
 	}
-	return &Value{nil, str}
+	return &Value{Value: str}
+}
+
+// textChunk must match _chunk in stdlib/text.fn
+const textChunk = 64
+
+// MkText makes a balanced Text, see stdlib/text.fn.
+func MkText(s string) *Value {
+	text, _ := mkText([]rune(s))
+	return text
+}
+
+func mkText(runes []rune) (text *Value, depth int) {
+	if len(runes) <= textChunk {
+		return MkUnion(0, MkInt64(int64(len(runes))), MkString(string(runes))), 0
+	}
+	chunks := (len(runes) + textChunk - 1) / textChunk
+	middle := (chunks + 1) / 2 * textChunk
+	left, leftDepth := mkText(runes[:middle])
+	right, rightDepth := mkText(runes[middle:])
+	depth = leftDepth + 1
+	if rightDepth > leftDepth {
+		depth = rightDepth + 1
+	}
+	return MkUnion(1, MkInt64(int64(len(runes))), MkInt64(int64(depth)), left, right), depth
+}
+
+// TextLength returns the number of characters of a Text without traversing it.
+func (v *Value) TextLength() int {
+	return int(v.Field(0).Int().Int64())
+}
+
+// Text converts a Text to a Go string, one chunk at a time.
+func (v *Value) Text() string {
+	var b strings.Builder
+	b.Grow(v.TextLength())
+	v.writeText(&b)
+	return b.String()
+}
+
+func (v *Value) writeText(b *strings.Builder) {
+	if v.Alternative() == 0 {
+		b.WriteString(v.Field(1).String())
+		return
+	}
+	v.Field(2).writeText(b)
+	v.Field(3).writeText(b)
+}
+
+// MkVector makes a balanced Vector, see stdlib/vector.fn. The nodes are made directly from the
+// elements, in linear time.
+func MkVector(elems ...*Value) *Value {
+	vector, _ := mkVector(elems)
+	return vector
+}
+
+func mkVector(elems []*Value) (vector *Value, height int) {
+	if len(elems) == 0 {
+		return MkUnion(0), 0
+	}
+	middle := len(elems) / 2
+	left, leftHeight := mkVector(elems[:middle])
+	right, rightHeight := mkVector(elems[middle+1:])
+	height = leftHeight + 1
+	if rightHeight > leftHeight {
+		height = rightHeight + 1
+	}
+	return MkUnion(1, MkInt64(int64(len(elems))), MkInt64(int64(height)), left, elems[middle], right), height
+}
+
+// Vector returns the elements of a Vector in order.
+func (v *Value) Vector() []*Value {
+	var elems []*Value
+	if v.Alternative() != 0 {
+		elems = make([]*Value, 0, int(v.Field(0).Int().Int64()))
+	}
+	return v.appendVector(elems)
+}
+
+func (v *Value) appendVector(elems []*Value) []*Value {
+	if v.Alternative() == 0 {
+		return elems
+	}
+	elems = v.Field(2).appendVector(elems)
+	elems = append(elems, v.Field(3))
+	return v.Field(4).appendVector(elems)
 }
@@ -0,0 +1,144 @@
+package runtime_test
+
+import (
+	"errors"
+	"regexp"
+	"testing"
+
+	"github.com/faiface/funky/runtime"
+)
+
+const valueSrc = prelude + `
+record Pair = left : Int, right : Char
+
+func a-char      : Char              = 'x'
+func an-int      : Int               = 42
+func a-float     : Float             = 2.5
+func str         : String            = "hi"
+func list        : List Int          = [1, 2, 3]
+func yes         : Bool              = true
+func pair        : Pair              = Pair 7 'p'
+func add         : Int -> Int -> Int = +
+func broken      : Int               = panic "broken"
+func broken-tail : List Int          = 1 :: panic "broken tail"
+`
+
+func TestAccessors(t *testing.T) {
+	env := testEnv(t, valueSrc)
+	names := []string{"a-char", "an-int", "a-float", "str", "list", "yes", "pair", "add", "broken", "broken-tail"}
+
+	tests := []struct {
+		global string
+		access func(v *runtime.Value) (interface{}, error)
+		want   interface{}
+		err    *regexp.Regexp // nil if the access succeeds
+	}{
+		// values
+		{"a-char", tryChar, 'x', nil},
+		{"an-int", tryInt, "42", nil},
+		{"a-float", tryFloat, 2.5, nil},
+		{"str", tryString, "hi", nil},
+		{"list", tryLength, 3, nil},
+		{"yes", tryBool, true, nil},
+		{"pair", tryAlternative, 0, nil},
+		{"pair", tryField(0, tryInt), "7", nil},
+		{"pair", tryField(1, tryChar), 'p', nil},
+		{"add", tryAdd, "3", nil},
+		{"an-int", tryReduce, nil, nil},
+
+		// kind mismatches
+		{"an-int", tryChar, nil, regexp.MustCompile(`^expected Char, got Int$`)},
+		{"a-char", tryInt, nil, regexp.MustCompile(`^expected Int, got Char$`)},
+		{"str", tryFloat, nil, regexp.MustCompile(`^expected Float, got record or union \(alternative 1, 2 fields\)$`)},
+		{"add", tryAlternative, nil, regexp.MustCompile(`^expected record or union, got function$`)},
+		{"an-int", tryBool, nil, regexp.MustCompile(`^expected record or union, got Int$`)},
+		{"list", tryString, nil, regexp.MustCompile(`^expected Char, got Int$`)},
+		{"a-float", tryField(0, tryInt), nil, regexp.MustCompile(`^expected record or union, got Float$`)},
+
+		// fields out of range
+		{"pair", tryField(2, tryInt), nil, regexp.MustCompile(`^expected field 2, got 2 fields$`)},
+		{"pair", tryField(-1, tryInt), nil, regexp.MustCompile(`^expected field -1, got 2 fields$`)},
+		{"yes", tryField(0, tryInt), nil, regexp.MustCompile(`^expected field 0, got 0 fields$`)},
+
+		// panics of the program
+		{"broken", tryInt, nil, regexp.MustCompile(`broken`)},
+		{"broken", tryReduce, nil, regexp.MustCompile(`broken`)},
+		{"broken-tail", tryLength, nil, regexp.MustCompile(`broken tail`)},
+	}
+
+	for backend, global := range backends(t, env, names...) {
+		for _, test := range tests {
+			got, err := test.access(global(test.global))
+			if test.err == nil {
+				if err != nil {
+					t.Errorf("%s: %s: %v", backend, test.global, err)
+				} else if got != test.want {
+					t.Errorf("%s: %s: got %v, want %v", backend, test.global, got, test.want)
+				}
+				continue
+			}
+			var runtimeErr *runtime.Error
+			if !errors.As(err, &runtimeErr) {
+				t.Errorf("%s: %s: got %v, want *runtime.Error", backend, test.global, err)
+			} else if !test.err.MatchString(runtimeErr.Msg) {
+				t.Errorf("%s: %s: got error %q, want %v", backend, test.global, runtimeErr.Msg, test.err)
+			}
+		}
+	}
+}
+
+func TestAccessorsPanic(t *testing.T) {
+	global := backends(t, testEnv(t, valueSrc), "an-int")["native"]
+	defer func() {
+		if _, ok := recover().(*runtime.Error); !ok {
+			t.Error("no panic with *runtime.Error")
+		}
+	}()
+	global("an-int").Char()
+}
+
+func tryChar(v *runtime.Value) (interface{}, error)        { return v.TryChar() }
+func tryFloat(v *runtime.Value) (interface{}, error)       { return v.TryFloat() }
+func tryString(v *runtime.Value) (interface{}, error)      { return v.TryString() }
+func tryBool(v *runtime.Value) (interface{}, error)        { return v.TryBool() }
+func tryAlternative(v *runtime.Value) (interface{}, error) { return v.TryAlternative() }
+func tryReduce(v *runtime.Value) (interface{}, error)      { return nil, v.Reduce() }
+
+func tryInt(v *runtime.Value) (interface{}, error) {
+	i, err := v.TryInt()
+	if err != nil {
+		return nil, err
+	}
+	return i.String(), nil
+}
+
+func tryLength(v *runtime.Value) (interface{}, error) {
+	list, err := v.TryList()
+	if err != nil {
+		return nil, err
+	}
+	for _, elem := range list {
+		if err := elem.Reduce(); err != nil {
+			return nil, err
+		}
+	}
+	return len(list), nil
+}
+
+func tryField(i int, access func(v *runtime.Value) (interface{}, error)) func(v *runtime.Value) (interface{}, error) {
+	return func(v *runtime.Value) (interface{}, error) {
+		field, err := v.TryField(i)
+		if err != nil {
+			return nil, err
+		}
+		return access(field)
+	}
+}
+
+func tryAdd(v *runtime.Value) (interface{}, error) {
+	sum, err := v.TryApply(runtime.MkInt64(1), runtime.MkInt64(2))
+	if err != nil {
+		return nil, err
+	}
+	return tryInt(sum)
+}
@@ -0,0 +1,32 @@
+package funky
+
+import (
+	"fmt"
+	"io"
+
+	"github.com/faiface/funky/compile"
+	"github.com/faiface/funky/parse"
+)
+
+func runSearch(w io.Writer, env *compile.Env, query string) error {
+	tokens, err := parse.Tokenize("search", query)
+	if err != nil {
+		return err
+	}
+	typ, err := parse.Type(tokens)
+	if err != nil {
+		return err
+	}
+	if typ == nil {
+		return fmt.Errorf("search: no type")
+	}
+	results, err := env.Search(typ)
+	if err != nil {
+		return err
+	}
+	for _, r := range results {
+		fmt.Fprintf(w, "%s : %v\n", r.Name, r.Type)
+		fmt.Fprintf(w, "  %v\n", env.SourceInfo(r.Name, r.Index))
+	}
+	return nil
+}
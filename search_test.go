@@ -0,0 +1,42 @@
+package funky
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestRunSearch(t *testing.T) {
+	env := testEnv(t, `
+union Foo = foo
+union Bar = bar
+
+func foo-to-bar : Foo -> Bar = \f bar
+func any-to-bar : a -> Bar   = \x bar
+`)
+	tests := []struct {
+		query    string
+		expected string
+		err      string
+	}{
+		{"Foo -> Bar", "foo-to-bar : Foo -> Bar\n  test.fn:5:32\nany-to-bar : a -> Bar\n  test.fn:6:32\n", ""},
+		{"Bar -> Foo", "", ""},
+		{"", "", "search: no type"},
+		{"Baz -> Bar", "", "type name does not exist: Baz"},
+	}
+	for _, test := range tests {
+		var out bytes.Buffer
+		err := runSearch(&out, env, test.query)
+		if test.err == "" && err != nil {
+			t.Errorf("%q: %v", test.query, err)
+			continue
+		}
+		if test.err != "" && (err == nil || !strings.Contains(err.Error(), test.err)) {
+			t.Errorf("%q: got error %v, want %q", test.query, err, test.err)
+			continue
+		}
+		if out.String() != test.expected {
+			t.Errorf("%q: got\n%s\nwant\n%s", test.query, out.String(), test.expected)
+		}
+	}
+}
@@ -0,0 +1,325 @@
+package funky
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/faiface/funky/compile"
+	"github.com/faiface/funky/expr"
+	"github.com/faiface/funky/parse"
+	"github.com/faiface/funky/runtime"
+	"github.com/faiface/funky/types"
+)
+
+// testPrefix starts the names of the functions run as tests
+const testPrefix = "test-"
+
+type testResult struct {
+	Name     string        `json:"name"`
+	Overload int           `json:"overload"`
+	Source   string        `json:"source"`
+	Passed   bool          `json:"passed"`
+	Message  string        `json:"message,omitempty"`
+	Duration time.Duration `json:"duration"`
+}
+
+// testOptions are the flags of funkytest that affect how the tests run
+type testOptions struct {
+	seed    int64         // seed of the random arguments of properties
+	runs    int           // number of random arguments each property is checked with
+	native  bool          // run the tests in native programs, which can be limited
+	budget  int           // number of reductions a test may take, 0 for no limit, needs native
+	timeout time.Duration // time a test may take, 0 for no limit, needs native
+}
+
+// Test runs all functions named test-... of type Bool or Result Nothing and reports which of
+// them passed. A test fails if it evaluates to false or to an error, if it panics, or if it
+// exceeds its budget of reductions or its timeout. Functions named test-... returning Bool from
+// arguments are properties, they get checked against random arguments. Test exits with
+// a non-zero status if any test fails.
+//
+// The tests run on crux, just like the programs run by Run. With -native, they run natively
+// instead, and only then -budget and -timeout limit them, because crux can't be interrupted.
+func Test() {
+	noStdlib := flag.Bool("nostd", false, "do not automatically include files from $FUNKY")
+	run := flag.String("run", "", "only run tests whose names match the regular expression")
+	verbose := flag.Bool("v", false, "print all tests, not only the failed ones")
+	jsonOutput := flag.String("json", "", "write the results as JSON into a file")
+	junitOutput := flag.String("junit", "", "write the results as JUnit XML into a file")
+	seed := flag.Int64("seed", time.Now().UnixNano(), "seed of the random arguments of properties")
+	runs := flag.Int("runs", 100, "number of random arguments each property is checked with")
+	native := flag.Bool("native", false, "run the tests natively, which makes -budget and -timeout possible")
+	budget := flag.Int("budget", 0, "number of reductions a test may take, 0 for no limit, needs -native")
+	timeout := flag.Duration("timeout", 0, "time a test may take, 0 for no limit, needs -native")
+	flag.Parse()
+
+	if !*native && (*budget > 0 || *timeout > 0) {
+		handleErrs(errors.New("-budget and -timeout need -native"))
+	}
+
+	filter, err := regexp.Compile(*run)
+	handleErrs(err)
+
+	definitions := readDefinitions(*noStdlib, "cmd", sourceArgs())
+
+	env := new(compile.Env)
+	for _, def := range definitions {
+		handleErrs(env.Add(def))
+	}
+	handleErrs(env.Validate()...)
+	handleErrs(env.TypeInfer()...)
+
+	results, errs := runTests(env, testNames(definitions, filter), testOptions{
+		seed:    *seed,
+		runs:    *runs,
+		native:  *native,
+		budget:  *budget,
+		timeout: *timeout,
+	})
+	handleErrs(errs...)
+
+	failed := 0
+	for _, result := range results {
+		if !result.Passed {
+			failed++
+			fmt.Printf("--- FAIL: %s (%v)\n", result.Name, result.Duration)
+			fmt.Printf("    %s: %s\n", result.Source, result.Message)
+		} else if *verbose {
+			fmt.Printf("--- PASS: %s (%v)\n", result.Name, result.Duration)
+		}
+	}
+	if failed > 0 {
+		fmt.Printf("FAIL: %d of %d tests failed\n", failed, len(results))
+	} else {
+		fmt.Printf("ok: %d tests passed\n", len(results))
+	}
+
+	if *jsonOutput != "" {
+		handleErrs(writeResults(*jsonOutput, results, writeJSON))
+	}
+	if *junitOutput != "" {
+		handleErrs(writeResults(*junitOutput, results, writeJUnit))
+	}
+
+	if failed > 0 {
+		os.Exit(1)
+	}
+}
+
+// testNames returns the names of the functions defined as test-... matching the filter, in the
+// order of their definitions
+func testNames(definitions []parse.Definition, filter *regexp.Regexp) []string {
+	var (
+		names   []string
+		visited = make(map[string]bool)
+	)
+	for _, def := range definitions {
+		if _, ok := def.Value.(expr.Expr); !ok || visited[def.Name] {
+			continue
+		}
+		visited[def.Name] = true
+		if strings.HasPrefix(def.Name, testPrefix) && filter.MatchString(def.Name) {
+			names = append(names, def.Name)
+		}
+	}
+	return names
+}
+
+// runTests compiles the tests at once, with all of them as the roots, and runs every overload of
+// them that has a test type. Each test runs in its own program, so that the tests don't share
+// evaluated globals. Native programs stop as soon as the test exceeds its limits.
+func runTests(env *compile.Env, names []string, options testOptions) ([]testResult, []error) {
+	if len(names) == 0 {
+		return nil, nil
+	}
+	newProgram, errs := testPrograms(env, names, options.native)
+	if len(errs) > 0 {
+		return nil, errs
+	}
+
+	var results []testResult
+	for _, name := range names {
+		for i := 0; env.TypeInfo(name, i) != nil; i++ {
+			if !isTestType(env.TypeInfo(name, i)) {
+				continue
+			}
+			program, globalIndices := newProgram()
+			results = append(results, runTest(env, program.Global(globalIndices[name][i]), name, i, options))
+		}
+	}
+	return results, nil
+}
+
+// testPrograms compiles the tests and returns the function making a new program of them,
+// together with the indices of the globals
+func testPrograms(env *compile.Env, names []string, native bool) (newProgram func() (*runtime.Program, map[string][]int32), errs []error) {
+	if native {
+		exprs, errs := env.Exprs(names...)
+		if len(errs) > 0 {
+			return nil, errs
+		}
+		return func() (*runtime.Program, map[string][]int32) {
+			return runtime.NewNativeProgram(exprs, env.OperatorArity)
+		}, nil
+	}
+	globalIndices, globalValues, _, _, _, errs := env.Compile(names...)
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	return func() (*runtime.Program, map[string][]int32) {
+		return runtime.NewProgram(globalValues), globalIndices
+	}, nil
+}
+
+func isTestType(t types.Type) bool {
+	if _, ok := propParams(t); ok {
+		return true
+	}
+	appl, ok := t.(*types.Appl)
+	if !ok {
+		return false
+	}
+	switch {
+	case appl.Name == "Bool" && len(appl.Args) == 0:
+		return true
+	case appl.Name == "Result" && len(appl.Args) == 1:
+		arg, ok := appl.Args[0].(*types.Appl)
+		return ok && arg.Name == "Nothing" && len(arg.Args) == 0
+	}
+	return false
+}
+
+// runTest evaluates the test, within the limits of the options if it's native. Any panic fails the test, so that
+// one broken test doesn't stop the others.
+func runTest(env *compile.Env, value *runtime.Value, name string, index int, options testOptions) (result testResult) {
+	result = testResult{
+		Name:     name,
+		Overload: index,
+		Source:   fmt.Sprint(env.SourceInfo(name, index)),
+	}
+
+	if options.native {
+		ctx := context.Background()
+		if options.timeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, options.timeout)
+			defer cancel()
+		}
+		value = value.WithLimits(&runtime.Limits{Context: ctx, MaxReductions: options.budget})
+	}
+
+	start := time.Now()
+	defer func() {
+		result.Duration = time.Since(start)
+		if r := recover(); r != nil {
+			result.Passed = false
+			switch r := r.(type) {
+			case *runtime.Error:
+				result.Message = "panic: " + r.Msg + formatStack(r.Stack, env.SourceInfo)
+			case *runtime.LimitError:
+				result.Message = r.Msg
+			default:
+				result.Message = fmt.Sprint("panic: ", r)
+			}
+		}
+	}()
+
+	if params, ok := propParams(env.TypeInfo(name, index)); ok {
+		message, err := checkProperty(env, value, params, options.seed, options.runs)
+		if err != nil {
+			message = err.Error()
+		}
+		result.Passed = message == ""
+		result.Message = message
+		return result
+	}
+
+	if env.TypeInfo(name, index).(*types.Appl).Name == "Bool" {
+		result.Passed = value.Bool()
+		if !result.Passed {
+			result.Message = "false"
+		}
+		return result
+	}
+	// Result Nothing, error is the first alternative
+	result.Passed = value.Alternative() != 0
+	if !result.Passed {
+		result.Message = value.Field(0).String()
+	}
+	return result
+}
+
+func writeResults(path string, results []testResult, write func(io.Writer, []testResult) error) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	err = write(f, results)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+func writeJSON(w io.Writer, results []testResult) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(results)
+}
+
+type junitSuite struct {
+	XMLName  xml.Name    `xml:"testsuite"`
+	Name     string      `xml:"name,attr"`
+	Tests    int         `xml:"tests,attr"`
+	Failures int         `xml:"failures,attr"`
+	Time     float64     `xml:"time,attr"`
+	Cases    []junitCase `xml:"testcase"`
+}
+
+type junitCase struct {
+	Name      string        `xml:"name,attr"`
+	Classname string        `xml:"classname,attr"`
+	Time      float64       `xml:"time,attr"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Text    string `xml:",chardata"`
+}
+
+func writeJUnit(w io.Writer, results []testResult) error {
+	suite := junitSuite{Name: "funky", Tests: len(results)}
+	for _, result := range results {
+		c := junitCase{
+			Name:      result.Name,
+			Classname: result.Source,
+			Time:      result.Duration.Seconds(),
+		}
+		if !result.Passed {
+			suite.Failures++
+			c.Failure = &junitFailure{Message: result.Message, Text: result.Source + ": " + result.Message}
+		}
+		suite.Time += c.Time
+		suite.Cases = append(suite.Cases, c)
+	}
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(suite); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
@@ -0,0 +1,106 @@
+package funky
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"testing"
+
+	"github.com/faiface/funky/parse"
+)
+
+func TestFunkyTests(t *testing.T) {
+	paths, err := filepath.Glob(filepath.Join("tests", "*.fn"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var definitions []parse.Definition
+	for _, path := range paths {
+		b, err := ioutil.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		definitions = append(definitions, parseDefinitions(t, path, string(b))...)
+	}
+	env := checkDefinitions(t, definitions)
+
+	// native programs also evaluate par-map in parallel
+	for _, native := range []bool{false, true} {
+		results, errs := runTests(env, testNames(definitions, regexp.MustCompile("")), testOptions{seed: 1, runs: 100, native: native})
+		for _, err := range errs {
+			t.Fatal(err)
+		}
+		if len(results) == 0 {
+			t.Fatal("no tests found")
+		}
+		for _, result := range results {
+			if !result.Passed {
+				t.Errorf("native %v: %s: %s: %s", native, result.Name, result.Source, result.Message)
+			}
+		}
+	}
+}
+
+func TestRunTests(t *testing.T) {
+	definitions := parseDefinitions(t, "test.fn", `
+func test-true  : Bool           = true
+func test-false : Bool           = false
+func test-ok    : Result Nothing = ok nothing
+func test-error : Result Nothing = error "broken"
+func test-panic : Bool           = panic "boom"
+func test-long  : Bool           = length (range 1 20000) > 0
+func test-after : Bool           = not false
+func test-prop  : Int -> Bool    = \x x < 5
+
+func test-overloaded : Bool   = true
+func test-overloaded : String = "not a test"
+
+func skipped-test : Bool = false
+`)
+	env := checkDefinitions(t, definitions)
+
+	// crux can't be limited and doesn't expose its stack
+	options := map[string]testOptions{
+		"crux":   {seed: 1, runs: 100},
+		"native": {seed: 1, runs: 100, native: true, budget: 10000},
+	}
+	for backend, options := range options {
+		results, errs := runTests(env, testNames(definitions, regexp.MustCompile("")), options)
+		for _, err := range errs {
+			t.Fatal(err)
+		}
+		want := []struct {
+			name    string
+			passed  bool
+			message *regexp.Regexp
+		}{
+			{"test-true", true, regexp.MustCompile(`^$`)},
+			{"test-false", false, regexp.MustCompile(`^false$`)},
+			{"test-ok", true, regexp.MustCompile(`^$`)},
+			{"test-error", false, regexp.MustCompile(`^broken$`)},
+			{"test-panic", false, regexp.MustCompile(`^panic: .*boom$`)},
+			{"test-long", true, regexp.MustCompile(`^$`)},
+			{"test-after", true, regexp.MustCompile(`^$`)},
+			{"test-prop", false, regexp.MustCompile(`on: 5$`)},
+			{"test-overloaded", true, regexp.MustCompile(`^$`)},
+		}
+		if options.native {
+			want[4].message = regexp.MustCompile(`^panic: .*boom\n  in test-panic/0 at test.fn:6:36$`)
+			want[5].passed, want[5].message = false, regexp.MustCompile(`limit exceeded`)
+		}
+		if len(results) != len(want) {
+			t.Fatalf("%s: got %d results, want %d", backend, len(results), len(want))
+		}
+		for i, result := range results {
+			if result.Name != want[i].name || result.Passed != want[i].passed || !want[i].message.MatchString(result.Message) {
+				t.Errorf("%s: got %s passed=%v %q, want %s passed=%v %v",
+					backend, result.Name, result.Passed, result.Message, want[i].name, want[i].passed, want[i].message)
+			}
+		}
+	}
+
+	results, _ := runTests(env, testNames(definitions, regexp.MustCompile("^test-(true|ok)$")), testOptions{})
+	if len(results) != 2 {
+		t.Errorf("got %d filtered results, want 2", len(results))
+	}
+}
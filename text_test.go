@@ -0,0 +1,46 @@
+package funky
+
+import (
+	"testing"
+
+	"github.com/faiface/funky/runtime"
+)
+
+func TestText(t *testing.T) {
+	env := testEnv(t, `
+func long : Text = text (join ", " (map string (range 0 99)))
+
+func split-commas : String = join "|" (map string (split (text ",") (text "a,,bc,")))
+func split-long   : String = string (length (split (text ", ") long))
+func split-none   : String = join "|" (map string (split (text "x") (text "abc")))
+func replaced     : String = string (replace (text "bc") (text "X") (text "abcabcab"))
+func index        : String = string (1000 ? index-of (text "50, 51") long)
+func equal        : String = join " " (map (\b if b "t" "f") [long == long, long == text "0", text "" == text ""])
+func less         : String = join " " (map (\b if b "t" "f") [text "ab" < text "b", long < text "0", text "" < text "a"])
+`)
+	tests := []struct {
+		name, want string
+	}{
+		{"split-commas", "a||bc|"},
+		{"split-long", "100"},
+		{"split-none", "abc"},
+		{"replaced", "aXaXab"},
+		{"index", "190"},
+		{"equal", "t f t"},
+		{"less", "t f t"},
+	}
+	for _, test := range tests {
+		prog, errs := compileProgram(env, test.name)
+		for _, err := range errs {
+			t.Fatal(err)
+		}
+		got, err := runtime.NewProgram(prog.globalValues).Global(prog.globalIndices[test.name][0]).TryString()
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("%s: got %q, want %q", test.name, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,137 @@
+package typecheck
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/faiface/funky/expr"
+	"github.com/faiface/funky/parse/parseinfo"
+	"github.com/faiface/funky/types"
+)
+
+const maxFits = 20 // maximum number of fitting functions reported for a hole
+
+type Hole struct {
+	SourceInfo *parseinfo.Source
+	Name       string
+	Type       types.Type
+	Locals     []Binding
+	Fits       []Binding
+	MoreFits   int // number of fitting functions not listed in Fits
+}
+
+type Binding struct {
+	Name string
+	Type types.Type
+}
+
+func (h *Hole) String() string {
+	s := fmt.Sprintf("%v: hole %s has type: %v", h.SourceInfo, h.Name, h.Type)
+	if len(h.Locals) > 0 {
+		s += "\n  local variables:"
+		for _, local := range h.Locals {
+			s += fmt.Sprintf("\n    %s : %v", local.Name, local.Type)
+		}
+	}
+	if len(h.Fits) > 0 {
+		s += "\n  fitting functions:"
+		for _, fit := range h.Fits {
+			s += fmt.Sprintf("\n    %s : %v", fit.Name, fit.Type)
+		}
+		if h.MoreFits > 0 {
+			s += fmt.Sprintf("\n    ... and %d more", h.MoreFits)
+		}
+	}
+	return s
+}
+
+func findHoles(names map[string]types.Name, global map[string][]types.Type, results []InferResult) []Hole {
+	var holes []Hole
+	for _, r := range results {
+		findHolesHelper(names, global, nil, r.Subst.ApplyToExpr(r.Expr), func(h Hole) {
+			// ambiguous results report the same hole multiple times, sometimes with the same type
+			for _, seen := range holes {
+				if seen.SourceInfo == h.SourceInfo && seen.Type.Equal(h.Type) {
+					return
+				}
+			}
+			holes = append(holes, h)
+		})
+	}
+	return holes
+}
+
+func findHolesHelper(
+	names map[string]types.Name,
+	global map[string][]types.Type,
+	scope []Binding,
+	e expr.Expr,
+	report func(Hole),
+) {
+	switch e := e.(type) {
+	case *expr.Hole:
+		hole := Hole{
+			SourceInfo: e.SourceInfo(),
+			Name:       e.Name,
+			Type:       e.TypeInfo(),
+		}
+		// innermost variables first, shadowed ones are skipped
+	scopeLoop:
+		for i := len(scope) - 1; i >= 0; i-- {
+			for _, local := range hole.Locals {
+				if local.Name == scope[i].Name {
+					continue scopeLoop
+				}
+			}
+			hole.Locals = append(hole.Locals, scope[i])
+		}
+		hole.Fits = fittingGlobals(names, global, hole.Type)
+		if len(hole.Fits) > maxFits {
+			hole.MoreFits = len(hole.Fits) - maxFits
+			hole.Fits = hole.Fits[:maxFits]
+		}
+		report(hole)
+	case *expr.Abst:
+		newScope := append(scope[:len(scope):len(scope)], Binding{e.Bound.Name, e.Bound.TypeInfo()})
+		findHolesHelper(names, global, newScope, e.Body, report)
+	case *expr.Appl:
+		findHolesHelper(names, global, scope, e.Left, report)
+		findHolesHelper(names, global, scope, e.Right, report)
+	case *expr.Strict:
+		findHolesHelper(names, global, scope, e.Expr, report)
+	case *expr.Switch:
+		findHolesHelper(names, global, scope, e.Expr, report)
+		for _, cas := range e.Cases {
+			findHolesHelper(names, global, scope, cas.Body, report)
+		}
+	}
+}
+
+// functions usable without specializing the hole type come first
+func fittingGlobals(names map[string]types.Name, global map[string][]types.Type, t types.Type) []Binding {
+	var exact, unifying []Binding
+	for name, ts := range global {
+		for _, gt := range ts {
+			if !CheckIfUnify(names, t, gt) {
+				continue
+			}
+			if IsSpec(names, gt, t) {
+				exact = append(exact, Binding{name, gt})
+			} else {
+				unifying = append(unifying, Binding{name, gt})
+			}
+		}
+	}
+	sortBindings(exact)
+	sortBindings(unifying)
+	return append(exact, unifying...)
+}
+
+func sortBindings(bindings []Binding) {
+	sort.SliceStable(bindings, func(i, j int) bool {
+		if bindings[i].Name != bindings[j].Name {
+			return bindings[i].Name < bindings[j].Name
+		}
+		return bindings[i].Type.String() < bindings[j].Type.String()
+	})
+}
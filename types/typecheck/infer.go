@@ -2,6 +2,7 @@ package typecheck
 
 import (
 	"fmt"
+	"sort"
 	"strings"
 
 	"github.com/faiface/funky/expr"
@@ -18,16 +19,14 @@ type (
 	CannotApplyError struct {
 		LeftSourceInfo  *parseinfo.Source
 		RightSourceInfo *parseinfo.Source
-		Cases           []struct {
-			Left types.Type
-			Err  error
-		}
+		Cases           ApplyCases
 	}
 
 	NoMatchError struct {
 		SourceInfo *parseinfo.Source
 		TypeInfo   types.Type
 		Results    []InferResult
+		Errs       []error // why the results don't match, if known
 	}
 
 	AmbiguousError struct {
@@ -38,25 +37,89 @@ type (
 
 	CannotSwitchError struct {
 		ExprSourceInfo *parseinfo.Source
-		Cases          []struct {
-			Expr types.Type
-			Err  error
-		}
+		Cases          SwitchCases
+	}
+
+	CaseError struct {
+		SourceInfo *parseinfo.Source
+		Alt        string
+		Required   types.Type
+		Err        error
+	}
+
+	HoleError struct {
+		Holes []Hole
 	}
 )
 
-func (err *CannotApplyError) AddCase(left types.Type, er error) {
-	err.Cases = append(err.Cases, struct {
-		Left types.Type
+type (
+	ApplyCase struct {
+		Left, Right types.Type
+		Err         error
+	}
+
+	SwitchCase struct {
+		Expr types.Type
 		Err  error
-	}{left, er})
+	}
+
+	ApplyCases  []ApplyCase
+	SwitchCases []SwitchCase
+)
+
+func (cs ApplyCases) Len() int      { return len(cs) }
+func (cs ApplyCases) Swap(i, j int) { cs[i], cs[j] = cs[j], cs[i] }
+func (cs ApplyCases) Less(i, j int) bool {
+	if l1, l2 := cs[i].Left.String(), cs[j].Left.String(); l1 != l2 {
+		return l1 < l2
+	}
+	if r1, r2 := cs[i].Right.String(), cs[j].Right.String(); r1 != r2 {
+		return r1 < r2
+	}
+	return cs[i].Err.Error() < cs[j].Err.Error()
+}
+
+func (cs SwitchCases) Len() int      { return len(cs) }
+func (cs SwitchCases) Swap(i, j int) { cs[i], cs[j] = cs[j], cs[i] }
+func (cs SwitchCases) Less(i, j int) bool {
+	if e1, e2 := cs[i].Expr.String(), cs[j].Expr.String(); e1 != e2 {
+		return e1 < e2
+	}
+	return cs[i].Err.Error() < cs[j].Err.Error()
+}
+
+func (err *CannotApplyError) AddCase(left, right types.Type, er error) {
+	err.Cases = append(err.Cases, ApplyCase{left, right, er})
 }
 
 func (err *CannotSwitchError) AddCase(exp types.Type, er error) {
-	err.Cases = append(err.Cases, struct {
-		Expr types.Type
-		Err  error
-	}{exp, er})
+	err.Cases = append(err.Cases, SwitchCase{exp, er})
+}
+
+// Sort sorts the cases and removes the duplicate ones.
+func (err *CannotApplyError) Sort() {
+	sort.Sort(err.Cases)
+	var cases ApplyCases
+	for i, cas := range err.Cases {
+		if i > 0 && !err.Cases.Less(i-1, i) {
+			continue
+		}
+		cases = append(cases, cas)
+	}
+	err.Cases = cases
+}
+
+// Sort sorts the cases and removes the duplicate ones.
+func (err *CannotSwitchError) Sort() {
+	sort.Sort(err.Cases)
+	var cases SwitchCases
+	for i, cas := range err.Cases {
+		if i > 0 && !err.Cases.Less(i-1, i) {
+			continue
+		}
+		cases = append(cases, cas)
+	}
+	err.Cases = cases
 }
 
 func (err *NotBoundError) Error() string {
@@ -67,7 +130,8 @@ func (err *CannotApplyError) Error() string {
 	s := fmt.Sprintf("%v: cannot apply; in case function has type:", err.LeftSourceInfo)
 	for _, cas := range err.Cases {
 		s += "\n" + cas.Left.String()
-		s += "\n" + indent(cas.Err.Error())
+		s += "\n" + indent("and argument has type: "+cas.Right.String())
+		s += "\n" + indent(indent(cas.Err.Error()))
 	}
 	return s
 }
@@ -92,18 +156,21 @@ func (err *NoMatchError) Error() string {
 	for _, r := range err.Results {
 		s += fmt.Sprintf("\n  %v", r.Type)
 	}
+	for _, er := range err.Errs {
+		s += "\n" + indent(er.Error())
+	}
 	return s
 }
 
 func (err *AmbiguousError) Error() string {
-	traversals := make([]<-chan expr.Expr, len(err.Results))
+	traversals := make([]<-chan traversed, len(err.Results))
 	for i := range traversals {
 		traversals[i] = traverse(err.Results[i].Subst.ApplyToExpr(err.Results[i].Expr))
 	}
 	// the idea is to concurrently traverse all inferred expressions and find the first
 	// variable that differs in type across the results and report it
 	for {
-		var exprs []expr.Expr
+		var exprs []traversed
 		for i := range traversals {
 			exprs = append(exprs, <-traversals[i])
 		}
@@ -111,6 +178,7 @@ func (err *AmbiguousError) Error() string {
 			if !exprs[0].TypeInfo().Equal(exprs[i].TypeInfo()) {
 				// we found one source of ambiguity, we report it
 				s := fmt.Sprintf("%v: ambiguous, multiple admissible types:", exprs[0].SourceInfo())
+				var admissible []types.Type
 			accumulateTypes:
 				for j, e := range exprs {
 					for k := 0; k < j; k++ {
@@ -118,8 +186,19 @@ func (err *AmbiguousError) Error() string {
 							continue accumulateTypes
 						}
 					}
+					admissible = append(admissible, e.TypeInfo())
 					s += fmt.Sprintf("\n  %v", e.TypeInfo())
 				}
+				// suggest annotations which pick each one of the admissible types, annotating
+				// a local variable doesn't help, its type comes from where it's bound
+				if exprs[0].local {
+					s += fmt.Sprintf("\nhint: %s is a local variable, annotate the function binding it or its argument", exprs[0].Expr)
+				} else {
+					s += "\nhint: disambiguate with a type annotation, one of:"
+					for _, t := range admissible {
+						s += fmt.Sprintf("\n  (%v : %v)", exprs[0].Expr, instType(new(int), t))
+					}
+				}
 				// drain traversals
 				for _, ch := range traversals {
 					for range ch {
@@ -140,29 +219,58 @@ func (err *CannotSwitchError) Error() string {
 	return s
 }
 
-func traverse(e expr.Expr) <-chan expr.Expr {
-	ch := make(chan expr.Expr)
+func (err *CaseError) Error() string {
+	s := fmt.Sprintf("%v: case %s must have type: %v", err.SourceInfo, err.Alt, err.Required)
+	s += "\n" + indent(err.Err.Error())
+	return s
+}
+
+func (err *HoleError) Error() string {
+	var s string
+	for i, hole := range err.Holes {
+		if i > 0 {
+			s += "\n"
+		}
+		s += hole.String()
+	}
+	return s
+}
+
+// traversed is a variable found by traverse, local ones are bound by abstractions
+type traversed struct {
+	expr.Expr
+	local bool
+}
+
+func traverse(e expr.Expr) <-chan traversed {
+	ch := make(chan traversed)
 	go func() {
-		traverseHelper(ch, e)
+		traverseHelper(ch, nil, e)
 		close(ch)
 	}()
 	return ch
 }
 
-func traverseHelper(ch chan<- expr.Expr, e expr.Expr) {
+func traverseHelper(ch chan<- traversed, locals []string, e expr.Expr) {
 	switch e := e.(type) {
 	case *expr.Var:
-		ch <- e
+		local := false
+		for _, name := range locals {
+			local = local || name == e.Name
+		}
+		ch <- traversed{e, local}
+	case *expr.Hole:
+		ch <- traversed{e, false}
 	case *expr.Abst:
-		ch <- e.Bound
-		traverseHelper(ch, e.Body)
+		ch <- traversed{e.Bound, true}
+		traverseHelper(ch, append(locals[:len(locals):len(locals)], e.Bound.Name), e.Body)
 	case *expr.Appl:
-		traverseHelper(ch, e.Right)
-		traverseHelper(ch, e.Left)
+		traverseHelper(ch, locals, e.Right)
+		traverseHelper(ch, locals, e.Left)
 	case *expr.Switch:
-		traverseHelper(ch, e.Expr)
+		traverseHelper(ch, locals, e.Expr)
 		for i := len(e.Cases) - 1; i >= 0; i-- {
-			traverseHelper(ch, e.Cases[i].Body)
+			traverseHelper(ch, locals, e.Cases[i].Body)
 		}
 	}
 }
@@ -177,12 +285,21 @@ func Infer(names map[string]types.Name, global map[string][]types.Type, e expr.E
 	varIndex := 0
 	e = instExpr(&varIndex, e)
 	results, err := infer(&varIndex, names, global, make(map[string]types.Type), e)
+	if ambig, ok := err.(*AmbiguousError); ok {
+		// holes are usually the very reason of the ambiguity, they're more helpful
+		if holes := findHoles(names, global, ambig.Results); len(holes) > 0 {
+			return nil, &HoleError{holes}
+		}
+	}
 	if err != nil {
 		return nil, err
 	}
 	for i := range results {
 		results[i].Expr = results[i].Subst.ApplyToExpr(results[i].Expr)
 	}
+	if holes := findHoles(names, global, results); len(holes) > 0 {
+		return nil, &HoleError{holes}
+	}
 	return results, nil
 }
 
@@ -210,7 +327,7 @@ func infer(
 			}
 		}
 		if len(filtered) == 0 {
-			err = &NoMatchError{e.SourceInfo(), e.TypeInfo(), results}
+			err = &NoMatchError{e.SourceInfo(), e.TypeInfo(), results, nil}
 			results = nil
 			return
 		}
@@ -253,6 +370,17 @@ func infer(
 		}
 		return results, nil
 
+	case *expr.Hole:
+		t := e.TypeInfo()
+		if t == nil {
+			t = newVar(varIndex)
+		}
+		return []InferResult{{
+			Type:  t,
+			Subst: nil,
+			Expr:  e.WithTypeInfo(t),
+		}}, nil
+
 	case *expr.Abst:
 		var (
 			bindType = e.Bound.TypeInfo()
@@ -310,17 +438,23 @@ func infer(
 		} else {
 			resultType = e.TypeInfo()
 		}
+		cannotApply := &CannotApplyError{
+			LeftSourceInfo:  e.Left.SourceInfo(),
+			RightSourceInfo: e.Right.SourceInfo(),
+		}
 		for _, rL := range resultsL {
 			for _, rR := range resultsR {
-				s, ok := rL.Subst.Unify(names, rR.Subst)
-				if !ok {
+				s, err := rL.Subst.UnifyExplain(names, rR.Subst)
+				if err != nil {
+					cannotApply.AddCase(rL.Type, rR.Type, err)
 					continue
 				}
-				st, ok := Unify(names, s.ApplyToType(rL.Type), &types.Func{
+				st, err := UnifyExplain(names, s.ApplyToType(rL.Type), &types.Func{
 					From: s.ApplyToType(rR.Type),
 					To:   resultType,
 				})
-				if !ok {
+				if err != nil {
+					cannotApply.AddCase(s.ApplyToType(rL.Type), s.ApplyToType(rR.Type), err)
 					continue
 				}
 				s = s.Compose(st)
@@ -338,7 +472,8 @@ func infer(
 		}
 
 		if len(results) == 0 {
-			return nil, fmt.Errorf("%v: type-checking error", e.Right.SourceInfo())
+			cannotApply.Sort()
+			return nil, cannotApply
 		}
 		return results, nil
 
@@ -348,13 +483,17 @@ func infer(
 			return nil, err
 		}
 
-		var results []InferResult
+		var (
+			results []InferResult
+			errs    []error
+		)
 
 		for _, rExpr := range resultsExpr {
 			s := rExpr.Subst
 			if e.TI != nil {
-				s1, ok := Unify(names, e.TI, rExpr.Type)
-				if !ok {
+				s1, err := UnifyExplain(names, e.TI, rExpr.Type)
+				if err != nil {
+					errs = append(errs, err)
 					continue
 				}
 				s = s.Compose(s1)
@@ -372,7 +511,7 @@ func infer(
 		}
 
 		if len(results) == 0 {
-			return nil, fmt.Errorf("%v: type-checking error", e.SourceInfo())
+			return nil, &NoMatchError{e.SourceInfo(), e.TI, resultsExpr, errs}
 		}
 
 		return results, nil
@@ -451,13 +590,16 @@ func infer(
 
 		results = nil
 
+		cannotSwitch := &CannotSwitchError{ExprSourceInfo: e.Expr.SourceInfo()}
+
 		for _, rExpr := range resultsExpr {
 			for unionIndex := range unionTypes {
 				unionType := unionTypes[unionIndex]
 				altTypes := altsTypes[unionIndex]
 
-				s, ok := Unify(names, rExpr.Type, unionType)
-				if !ok {
+				s, err := UnifyExplain(names, rExpr.Type, unionType)
+				if err != nil {
+					cannotSwitch.AddCase(rExpr.Type, err)
 					continue
 				}
 
@@ -470,18 +612,21 @@ func infer(
 					var (
 						newSubsts []Subst
 						newExprs  []*expr.Switch
+						lastErr   error
 					)
 					for i := range substs {
 						subst := substs[i]
 						exp := exprs[i]
 						for _, resultCase := range resultsCases[altIndex] {
-							s, ok := Unify(names, altType, resultCase.Subst.ApplyToType(resultCase.Type))
-							if !ok {
+							s, err := UnifyExplain(names, altType, resultCase.Subst.ApplyToType(resultCase.Type))
+							if err != nil {
+								lastErr = err
 								continue
 							}
 							newSubst := resultCase.Subst.Compose(s)
-							newSubst, ok = newSubst.Unify(names, subst)
-							if !ok {
+							newSubst, err = newSubst.UnifyExplain(names, subst)
+							if err != nil {
+								lastErr = err
 								continue
 							}
 							newSubsts = append(newSubsts, newSubst)
@@ -496,6 +641,14 @@ func infer(
 							})
 						}
 					}
+					if len(newSubsts) == 0 && len(substs) > 0 {
+						cannotSwitch.AddCase(substs[0].ApplyToType(rExpr.Type), &CaseError{
+							SourceInfo: e.Cases[altIndex].SI,
+							Alt:        e.Cases[altIndex].Alt,
+							Required:   substs[0].ApplyToType(altType),
+							Err:        lastErr,
+						})
+					}
 					substs = newSubsts
 					exprs = newExprs
 				}
@@ -518,7 +671,8 @@ func infer(
 		}
 
 		if len(results) == 0 {
-			return nil, fmt.Errorf("%v: type-checking error", e.SourceInfo())
+			cannotSwitch.Sort()
+			return nil, cannotSwitch
 		}
 
 		return results, nil
@@ -531,7 +685,7 @@ func newVar(varIndex *int) *types.Var {
 	name := ""
 	i := *varIndex + 1
 	for i > 0 {
-		name = string('a'+(i-1)%26) + name
+		name = string(rune('a'+(i-1)%26)) + name
 		i = (i - 1) / 26
 	}
 	v := &types.Var{Name: name}
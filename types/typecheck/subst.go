@@ -19,12 +19,17 @@ func (s Subst) Compose(s1 Subst) Subst {
 }
 
 func (s Subst) Unify(names map[string]types.Name, s1 Subst) (s2 Subst, ok bool) {
+	s2, err := s.UnifyExplain(names, s1)
+	return s2, err == nil
+}
+
+func (s Subst) UnifyExplain(names map[string]types.Name, s1 Subst) (s2 Subst, err error) {
 	s2 = make(Subst)
 	for v, t := range s {
 		if t1, ok := s1[v]; ok {
-			suni, ok := Unify(names, s2.ApplyToType(t), s2.ApplyToType(t1))
-			if !ok {
-				return nil, false
+			suni, err := UnifyExplain(names, s2.ApplyToType(t), s2.ApplyToType(t1))
+			if err != nil {
+				return nil, err
 			}
 			s2 = s2.Compose(suni)
 		}
@@ -35,7 +40,7 @@ func (s Subst) Unify(names map[string]types.Name, s1 Subst) (s2 Subst, ok bool)
 	for v, t := range s1 {
 		s2[v] = s2.ApplyToType(t)
 	}
-	return s2, true
+	return s2, nil
 }
 
 func (s Subst) ApplyToType(t types.Type) types.Type {
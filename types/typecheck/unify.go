@@ -1,9 +1,59 @@
 package typecheck
 
 import (
+	"fmt"
+
 	"github.com/faiface/funky/types"
 )
 
+type UnifyError struct {
+	Left, Right types.Type // types being unified
+
+	// innermost types that failed to unify
+	MismatchLeft, MismatchRight types.Type
+	Occurs                      bool // MismatchLeft is a variable contained in MismatchRight
+
+	names map[string]types.Name // for expanding the aliases, nil if not explained
+}
+
+// Expanded returns the types being unified with all aliases expanded, nil if there were no
+// aliases. It's computed on each call, because most failed unifications never get reported.
+func (err *UnifyError) Expanded() (left, right types.Type) {
+	if err.names == nil {
+		return nil, nil
+	}
+	left, right = ExpandAliases(err.names, err.Left), ExpandAliases(err.names, err.Right)
+	if left.Equal(err.Left) && right.Equal(err.Right) {
+		return nil, nil
+	}
+	return left, right
+}
+
+func (err *UnifyError) Error() string {
+	s := fmt.Sprintf("cannot unify %v with %v", err.Left, err.Right)
+	if err.Occurs {
+		s += fmt.Sprintf(": %v occurs in %v", err.MismatchLeft, err.MismatchRight)
+	} else {
+		s += fmt.Sprintf(": %s is not %s", constructor(err.MismatchLeft), constructor(err.MismatchRight))
+	}
+	if left, right := err.Expanded(); left != nil {
+		s += fmt.Sprintf("\naliases expanded: %v with %v", left, right)
+	}
+	return s
+}
+
+func constructor(t types.Type) string {
+	switch t := t.(type) {
+	case *types.Var:
+		return t.Name
+	case *types.Appl:
+		return t.Name
+	case *types.Func:
+		return "->"
+	}
+	return fmt.Sprint(t)
+}
+
 func CheckIfUnify(names map[string]types.Name, t, u types.Type) bool {
 	varIndex := 0
 	t = instType(&varIndex, t)
@@ -13,9 +63,27 @@ func CheckIfUnify(names map[string]types.Name, t, u types.Type) bool {
 }
 
 func Unify(names map[string]types.Name, t, u types.Type) (Subst, bool) {
+	s, err := unify(names, t, u)
+	return s, err == nil
+}
+
+func UnifyExplain(names map[string]types.Name, t, u types.Type) (Subst, error) {
+	s, err := unify(names, t, u)
+	if err != nil {
+		err.Left, err.Right, err.names = t, u, names
+		return nil, err
+	}
+	return s, nil
+}
+
+func unify(names map[string]types.Name, t, u types.Type) (Subst, *UnifyError) {
 	if v2, ok := u.(*types.Var); ok {
 		if v1, ok := t.(*types.Var); !ok || lesserName(v1.Name, v2.Name) {
-			return Unify(names, u, t)
+			s, err := unify(names, u, t)
+			if err != nil {
+				err.MismatchLeft, err.MismatchRight = err.MismatchRight, err.MismatchLeft
+			}
+			return s, err
 		}
 	}
 
@@ -25,54 +93,54 @@ func Unify(names map[string]types.Name, t, u types.Type) (Subst, bool) {
 			// occurence check fail
 			// variable t is contained in the type u
 			// final type would have to be infinitely recursive
-			return nil, false
+			return nil, &UnifyError{MismatchLeft: t, MismatchRight: u, Occurs: true}
 		}
-		return Subst{t.Name: u}, true
+		return Subst{t.Name: u}, nil
 
 	case *types.Appl:
 		applU, ok := u.(*types.Appl)
 		if !ok || t.Name != applU.Name || len(t.Args) != len(applU.Args) {
 			if alias, ok := names[t.Name].(*types.Alias); ok {
-				return Unify(names, revealAlias(alias, t.Args), u)
+				return unify(names, revealAlias(alias, t.Args), u)
 			}
 			if ok {
 				if alias, ok := names[applU.Name].(*types.Alias); ok {
-					return Unify(names, t, revealAlias(alias, applU.Args))
+					return unify(names, t, revealAlias(alias, applU.Args))
 				}
 			}
-			return nil, false
+			return nil, &UnifyError{MismatchLeft: t, MismatchRight: u}
 		}
 		s := Subst(nil)
 		for i := range t.Args {
 			// unify application arguments one by one
 			// while composing the final substitution
-			s1, ok := Unify(names, s.ApplyToType(t.Args[i]), s.ApplyToType(applU.Args[i]))
-			if !ok {
-				return nil, false
+			s1, err := unify(names, s.ApplyToType(t.Args[i]), s.ApplyToType(applU.Args[i]))
+			if err != nil {
+				return nil, err
 			}
 			s = s.Compose(s1)
 		}
-		return s, true
+		return s, nil
 
 	case *types.Func:
 		if applU, ok := u.(*types.Appl); ok {
 			if alias, ok := names[applU.Name].(*types.Alias); ok {
-				return Unify(names, t, revealAlias(alias, applU.Args))
+				return unify(names, t, revealAlias(alias, applU.Args))
 			}
 		}
 		funcU, ok := u.(*types.Func)
 		if !ok {
-			return nil, false
+			return nil, &UnifyError{MismatchLeft: t, MismatchRight: u}
 		}
-		s1, ok := Unify(names, t.From, funcU.From)
-		if !ok {
-			return nil, false
+		s1, err := unify(names, t.From, funcU.From)
+		if err != nil {
+			return nil, err
 		}
-		s2, ok := Unify(names, s1.ApplyToType(t.To), s1.ApplyToType(funcU.To))
-		if !ok {
-			return nil, false
+		s2, err := unify(names, s1.ApplyToType(t.To), s1.ApplyToType(funcU.To))
+		if err != nil {
+			return nil, err
 		}
-		return s1.Compose(s2), true
+		return s1.Compose(s2), nil
 	}
 
 	panic("unreachable")
@@ -99,6 +167,17 @@ func lesserName(s, t string) bool {
 	return s < t
 }
 
+func ExpandAliases(names map[string]types.Name, t types.Type) types.Type {
+	return t.Map(func(t types.Type) types.Type {
+		if appl, ok := t.(*types.Appl); ok {
+			if alias, ok := names[appl.Name].(*types.Alias); ok {
+				return ExpandAliases(names, revealAlias(alias, appl.Args))
+			}
+		}
+		return t
+	})
+}
+
 func revealAlias(alias *types.Alias, args []types.Type) types.Type {
 	s := make(Subst)
 	for i := range alias.Args {
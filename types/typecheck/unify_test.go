@@ -0,0 +1,74 @@
+package typecheck
+
+import (
+	"testing"
+
+	"github.com/faiface/funky/types"
+)
+
+func TestUnifyExplain(t *testing.T) {
+	var (
+		a       = &types.Var{Name: "a"}
+		intT    = &types.Appl{Name: "Int"}
+		listOf  = func(t types.Type) types.Type { return &types.Appl{Name: "List", Args: []types.Type{t}} }
+		funcOf  = func(from, to types.Type) types.Type { return &types.Func{From: from, To: to} }
+		strings = &types.Appl{Name: "Strings"}
+		names   = map[string]types.Name{
+			"Int":     &types.Builtin{},
+			"List":    &types.Builtin{NumArgs: 1},
+			"Strings": &types.Alias{Type: listOf(listOf(intT))},
+		}
+	)
+	tests := []struct {
+		t, u     types.Type
+		expected string
+	}{
+		{listOf(intT), funcOf(intT, intT), "cannot unify List Int with Int -> Int: List is not ->"},
+		{a, listOf(a), "cannot unify a with List a: a occurs in List a"},
+		{funcOf(intT, a), funcOf(listOf(intT), intT), "cannot unify Int -> a with List Int -> Int: Int is not List"},
+		{strings, listOf(intT), "cannot unify Strings with List Int: List is not Int\naliases expanded: List (List Int) with List Int"},
+	}
+	for _, test := range tests {
+		_, err := UnifyExplain(names, test.t, test.u)
+		if err == nil {
+			t.Errorf("%v with %v: expected an error", test.t, test.u)
+			continue
+		}
+		if err.Error() != test.expected {
+			t.Errorf("%v with %v:\nexpected: %s\ngot:      %s", test.t, test.u, test.expected, err)
+		}
+	}
+}
+
+func TestUnifyErrorWithoutMismatch(t *testing.T) {
+	// must not panic on types it doesn't know
+	err := &UnifyError{Left: &types.Appl{Name: "Int"}, Right: &types.Appl{Name: "Char"}}
+	if err.Error() == "" {
+		t.Error("empty error message")
+	}
+}
+
+func TestUnifyErrorExpanded(t *testing.T) {
+	var (
+		intT    = &types.Appl{Name: "Int"}
+		listInt = &types.Appl{Name: "List", Args: []types.Type{intT}}
+		ints    = &types.Appl{Name: "Ints"}
+		names   = map[string]types.Name{
+			"Int":  &types.Builtin{},
+			"List": &types.Builtin{NumArgs: 1},
+			"Ints": &types.Alias{Type: listInt},
+		}
+	)
+	// the aliases only get expanded by UnifyExplain and only when asked for
+	if _, err := unify(names, ints, intT); err.names != nil {
+		t.Error("unify kept the names")
+	}
+	_, err := UnifyExplain(names, ints, intT)
+	if left, right := err.(*UnifyError).Expanded(); !left.Equal(listInt) || !right.Equal(intT) {
+		t.Errorf("got %v with %v, want List Int with Int", left, right)
+	}
+	_, err = UnifyExplain(names, listInt, intT)
+	if left, right := err.(*UnifyError).Expanded(); left != nil || right != nil {
+		t.Errorf("got %v with %v without aliases", left, right)
+	}
+}
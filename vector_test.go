@@ -0,0 +1,162 @@
+package funky
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/faiface/funky/runtime"
+)
+
+func TestVector(t *testing.T) {
+	env := testEnv(t, `
+func hundred : Vector Int = vector (range 0 99)
+
+func show : Vector Int -> String = \v join " " (map string (list v))
+
+func length-all : String = join " " (map (string . length) [empty, hundred, pop hundred, push 7 hundred])
+func at-all     : String = join " " (map (\i "-" ? map string (at i hundred)) [-1, 0, 7, 8, 71, 72, 99, 100])
+func updated    : String = show (slice 70 4 (at 72 (* 10) hundred))
+func pushed     : String = show (push 3 (push 2 (push 1 empty)))
+func popped     : String = show (pop (pop (vector [1, 2, 3])))
+func inserted   : String = show (insert 1 9 (vector [1, 2, 3]))
+func sliced     : String = show (slice 62 5 hundred)
+func joined     : String = show (vector [1, 2] ++ vector [3] ++ empty)
+func mapped     : String = show (map (* 2) (take 4 hundred))
+func popped-all : String = string (length (iterate pop hundred |> drop 100 |> first!))
+
+func array-at    : String = join " " (map (\i string (at i (array 0 [1, 2, 3]))) [-1, 0, 2, 3])
+func array-set   : String = join " " (map (\i string (at i (at -3 (+ 5) (at 10 (+ 1) (empty 0))))) [-3, -2, 9, 10, 11])
+func array-reset : String = join " " (map (\i string (at i (reset 1 (array 0 [1, 2, 3])))) [0, 1, 2])
+func array-swap  : String = join " " (map (\i string (at i (swap 0 2 (array 0 [1, 2, 3])))) [0, 1, 2])
+func field-at    : String = join " " (map (\p string (at (first p) (second p) (reset 0 1 (field 0 [[1, 2], [3, 4]])))) [pair 0 0, pair 0 1, pair 1 0, pair 1 1, pair 5 5])
+func array-far   : String = join " " (map (\i string (at i (at -1000000 (+ 2) (at 1000000 (+ 1) (empty 0))))) [-1000000, 0, 999999, 1000000])
+func array-empty : String = join " " (map (\a if (empty? a) "empty" "set") [empty 0, reset 1000 (at 1000 (+ 1) (empty 0)), reset 7 (array 0 [1, 2])])
+func field-empty : String = if (empty? (_rows (reset 1 1 (at 1 1 (+ 1) (empty 0))))) "empty" "set"
+`)
+	tests := []struct {
+		name, want string
+	}{
+		{"length-all", "0 100 99 101"},
+		{"at-all", "- 0 7 8 71 72 99 -"},
+		{"updated", "70 71 720 73"},
+		{"pushed", "1 2 3"},
+		{"popped", "1"},
+		{"inserted", "1 9 2 3"},
+		{"sliced", "62 63 64 65 66"},
+		{"joined", "1 2 3"},
+		{"mapped", "0 2 4 6"},
+		{"popped-all", "0"},
+		{"array-at", "0 1 3 0"},
+		{"array-set", "5 0 0 1 0"},
+		{"array-reset", "1 0 3"},
+		{"array-swap", "3 2 1"},
+		{"field-at", "1 0 3 4 0"},
+		{"array-far", "2 0 0 1"},
+		{"array-empty", "empty empty set"},
+		{"field-empty", "empty"},
+	}
+	for _, test := range tests {
+		prog, errs := compileProgram(env, test.name)
+		for _, err := range errs {
+			t.Fatal(err)
+		}
+		got, err := runtime.NewProgram(prog.globalValues).Global(prog.globalIndices[test.name][0]).TryString()
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		if got != test.want {
+			t.Errorf("%s: got %q, want %q", test.name, got, test.want)
+		}
+	}
+}
+
+func TestMkVector(t *testing.T) {
+	env := testEnv(t, `
+func hundred : Vector Int = vector (range 0 99)
+
+func show : Vector Int -> String = \v join " " (map string (list v))
+`)
+	elems := compileGlobal(t, env, "hundred").Vector()
+	if len(elems) != 100 {
+		t.Fatalf("got %d elements, want 100", len(elems))
+	}
+	for i, elem := range elems {
+		if got := elem.Int().Int64(); got != int64(i) {
+			t.Errorf("element %d: got %d", i, got)
+		}
+	}
+
+	show := compileGlobal(t, env, "show")
+	for _, n := range []int{0, 1, 8, 9, 80} {
+		var (
+			elems []*runtime.Value
+			want  []string
+		)
+		for i := 0; i < n; i++ {
+			elems = append(elems, runtime.MkInt64(int64(i)))
+			want = append(want, fmt.Sprint(i))
+		}
+		got, err := show.Apply(runtime.MkVector(elems...)).TryString()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != strings.Join(want, " ") {
+			t.Errorf("%d elements: got %q", n, got)
+		}
+		if back := runtime.MkVector(elems...).Vector(); len(back) != n {
+			t.Errorf("%d elements: got %d back", n, len(back))
+		}
+	}
+}
+
+// TestVectorLogarithmic checks that the operations take O(log n) reductions, even on huge
+// vectors and arrays
+func TestVectorLogarithmic(t *testing.T) {
+	env := testEnv(t, `
+func joined  : Vector Int -> Vector Int -> Int = \a \b length (a ++ b)
+func sliced  : Vector Int -> Int               = \v at! 100 (slice 20000 30000 v)
+func inserted : Vector Int -> Int              = \v at! 50000 (insert 50000 7 v)
+func far     : Int                             = at 1000000000 (at 1000000000 (+ 1) (empty 0))
+`)
+	elems := make([]*runtime.Value, 100000)
+	for i := range elems {
+		elems[i] = runtime.MkInt64(int64(i))
+	}
+	vector := runtime.MkVector(elems...)
+
+	tests := []struct {
+		name string
+		args []*runtime.Value
+		want int64
+	}{
+		{"joined", []*runtime.Value{vector, vector}, 200000},
+		{"sliced", []*runtime.Value{vector}, 20100},
+		{"inserted", []*runtime.Value{vector}, 7},
+		{"far", nil, 1},
+	}
+	for _, test := range tests {
+		prog, errs := compileProgram(env, test.name)
+		for _, err := range errs {
+			t.Fatal(err)
+		}
+		program := runtime.NewProgram(prog.globalValues)
+		value := program.Global(prog.globalIndices[test.name][0])
+		if len(test.args) > 0 {
+			value = value.Apply(test.args...)
+		}
+		got, err := value.TryInt()
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		if got.Int64() != test.want {
+			t.Errorf("%s: got %v, want %d", test.name, got, test.want)
+		}
+		// linear operations would take at least one reduction per element
+		if reductions := program.Stats().Reductions; reductions > 20000 {
+			t.Errorf("%s: took %d reductions", test.name, reductions)
+		}
+	}
+}